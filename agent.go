@@ -0,0 +1,110 @@
+// Copyright 2017, Carlo Strub <cs@carlostrub.ch>
+// BSD 3-Clause License, see LICENSE file for details.
+
+package main
+
+import (
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"io"
+	"net"
+	"os"
+	"time"
+)
+
+// Messages of the ssh-agent protocol, see draft-miller-ssh-agent
+const (
+	agentRequestIdentities = 11
+	agentIdentitiesAnswer  = 12
+)
+
+// maxAgentReply bounds the size of a reply of the agent.
+const maxAgentReply = 256 * 1024
+
+var errAgentReply = errors.New("invalid reply from ssh-agent")
+
+// agentKeys returns the public keys held by the ssh-agent listening on
+// $SSH_AUTH_SOCK, in the format of OpenSSH .pub files. Without an agent,
+// there are no keys.
+func agentKeys() ([]string, error) {
+	socket := os.Getenv("SSH_AUTH_SOCK")
+	if socket == "" {
+		return nil, nil
+	}
+
+	conn, err := net.DialTimeout("unix", socket, 5*time.Second)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(5 * time.Second))
+
+	_, err = conn.Write([]byte{0, 0, 0, 1, agentRequestIdentities})
+	if err != nil {
+		return nil, err
+	}
+
+	var length uint32
+	err = binary.Read(conn, binary.BigEndian, &length)
+	if err != nil {
+		return nil, err
+	}
+	if length == 0 || length > maxAgentReply {
+		return nil, errAgentReply
+	}
+	reply := make([]byte, length)
+	_, err = io.ReadFull(conn, reply)
+	if err != nil {
+		return nil, err
+	}
+
+	return parseAgentIdentities(reply)
+}
+
+// parseAgentIdentities parses an SSH2_AGENT_IDENTITIES_ANSWER message.
+func parseAgentIdentities(reply []byte) ([]string, error) {
+	if len(reply) < 5 || reply[0] != agentIdentitiesAnswer {
+		return nil, errAgentReply
+	}
+	n := binary.BigEndian.Uint32(reply[1:5])
+	rest := reply[5:]
+
+	var keys []string
+	for i := uint32(0); i < n; i++ {
+		var blob, comment []byte
+		var ok bool
+		if blob, rest, ok = agentString(rest); !ok {
+			return nil, errAgentReply
+		}
+		if comment, rest, ok = agentString(rest); !ok {
+			return nil, errAgentReply
+		}
+		// The blob starts with the key type
+		typ, _, ok := agentString(blob)
+		if !ok {
+			return nil, errAgentReply
+		}
+
+		key := string(typ) + " " + base64.StdEncoding.EncodeToString(blob)
+		if len(comment) > 0 {
+			key += " " + string(comment)
+		}
+		keys = append(keys, key)
+	}
+
+	return keys, nil
+}
+
+// agentString splits a length prefixed string off b.
+func agentString(b []byte) (s, rest []byte, ok bool) {
+	if len(b) < 4 {
+		return nil, nil, false
+	}
+	n := binary.BigEndian.Uint32(b)
+	if uint32(len(b)-4) < n {
+		return nil, nil, false
+	}
+
+	return b[4 : 4+n], b[4+n:], true
+}
@@ -0,0 +1,80 @@
+// Copyright 2017, Carlo Strub <cs@carlostrub.ch>
+// BSD 3-Clause License, see LICENSE file for details.
+
+package main
+
+import (
+	"encoding/base64"
+	"encoding/binary"
+	"reflect"
+	"testing"
+)
+
+// agentUint32 encodes n as in the messages of ssh-agent.
+func agentUint32(n uint32) []byte {
+	b := make([]byte, 4)
+	binary.BigEndian.PutUint32(b, n)
+	return b
+}
+
+// agentBytes encodes s as a length prefixed string.
+func agentBytes(s []byte) []byte {
+	return append(agentUint32(uint32(len(s))), s...)
+}
+
+// agentAnswer builds an SSH2_AGENT_IDENTITIES_ANSWER claiming count
+// identities, followed by the given parts.
+func agentAnswer(count uint32, parts ...[]byte) []byte {
+	reply := append([]byte{agentIdentitiesAnswer}, agentUint32(count)...)
+	for _, part := range parts {
+		reply = append(reply, part...)
+	}
+	return reply
+}
+
+func TestParseAgentIdentities(t *testing.T) {
+	ed25519 := append(agentBytes([]byte("ssh-ed25519")), agentBytes([]byte("0123456789abcdef0123456789abcdef"))...)
+	rsa := append(agentBytes([]byte("ssh-rsa")), agentBytes([]byte{1, 0, 1})...)
+
+	for _, c := range []struct {
+		name  string
+		reply []byte
+		keys  []string
+		ok    bool
+	}{
+		{
+			name: "valid",
+			reply: agentAnswer(2,
+				agentBytes(ed25519), agentBytes([]byte("cs@laptop")),
+				agentBytes(rsa), agentBytes(nil)),
+			keys: []string{
+				"ssh-ed25519 " + base64.StdEncoding.EncodeToString(ed25519) + " cs@laptop",
+				"ssh-rsa " + base64.StdEncoding.EncodeToString(rsa),
+			},
+			ok: true,
+		},
+		{name: "no identities", reply: agentAnswer(0), ok: true},
+		{name: "empty", reply: nil},
+		{name: "wrong message", reply: []byte{5, 0, 0, 0, 0}},
+		{name: "truncated count", reply: []byte{agentIdentitiesAnswer, 0, 0}},
+		{name: "count beyond payload", reply: agentAnswer(3, agentBytes(ed25519), agentBytes(nil))},
+		{name: "huge count", reply: agentAnswer(0xffffffff, agentBytes(ed25519), agentBytes(nil))},
+		{name: "truncated blob prefix", reply: agentAnswer(1, []byte{0, 0})},
+		{name: "blob beyond payload", reply: agentAnswer(1, agentUint32(100), ed25519)},
+		{name: "huge blob length", reply: agentAnswer(1, agentUint32(0xffffffff), ed25519)},
+		{name: "missing comment", reply: agentAnswer(1, agentBytes(ed25519))},
+		{name: "truncated comment", reply: agentAnswer(1, agentBytes(ed25519), agentUint32(10), []byte("cs@"))},
+		{name: "blob without key type", reply: agentAnswer(1, agentBytes([]byte{0, 0, 0, 9, 's'}), agentBytes(nil))},
+	} {
+		keys, err := parseAgentIdentities(c.reply)
+		if !c.ok {
+			if err != errAgentReply {
+				t.Errorf("%s: got keys %q and error %v, want %v", c.name, keys, err, errAgentReply)
+			}
+			continue
+		}
+		if err != nil || !reflect.DeepEqual(keys, c.keys) {
+			t.Errorf("%s: got keys %q and error %v, want %q", c.name, keys, err, c.keys)
+		}
+	}
+}
@@ -0,0 +1,880 @@
+// Copyright 2017, Carlo Strub <cs@carlostrub.ch>
+// BSD 3-Clause License, see LICENSE file for details.
+
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"cost.li/bapu/gandi"
+	"github.com/gizak/termui"
+	"github.com/nsf/termbox-go"
+)
+
+// Tabs of the main screen
+const (
+	tabVMs = iota
+	tabDisks
+	tabNetwork
+	tabVLANs
+	tabKeys
+)
+
+// tabNames are the titles of the tabs, commands the keys available on them.
+var (
+	tabNames = []string{"Virtual Machines", "Disks", "Network", "VLANs", "SSH Keys"}
+	commands = []string{
+		"Virtual Machine: <[C]reate> <[S]tart> <St[o]p> <[R]eboot> <SS[H]> <R[e]size> <[M]igrate> <[K]ernel> <Co[n]sole> <[D]elete> <Enter> Details",
+		"Disk: <[C]reate> <Re[n]ame> <R[e]size> <[D]elete> <A[t]tach> <[X] Detach> <Sna[p]shots> <[K]ernel> <Enter> Details",
+		"Interface: <[C]reate> <A[t]tach> <[X] Detach> <[R]elease unused> <Re[v]erse DNS> <Enter> Details",
+		"VLAN: <[C]reate> <Re[n]ame> <Gate[w]ay> <[D]elete> <Add [I]nterface> <Enter> Members",
+		"SSH key: <[I]mport> <[D]elete> <Enter> Details",
+	}
+)
+
+// app holds the state of the terminal UI. termui runs every handler in its
+// own goroutine, hence all fields are guarded by the embedded mutex.
+type app struct {
+	sync.Mutex
+
+	client      *gandi.Client
+	profile     Profile
+	datacenters *datacenterCache
+	refresh     *refresher
+	operations  *operationTracker
+	stop        context.CancelFunc    // stops the background work of the profile
+	consoles    map[int]*consoleTimer // disable emergency consoles by VM id
+
+	refreshInterval time.Duration
+	refreshTimeout  time.Duration
+
+	refreshed time.Time // when the account was last fetched
+	account   gandi.AccountReturn
+	vmCount   int
+	vms       []gandi.VMReturn
+	disks     []gandi.DiskReturn
+	ifaces    []gandi.IfaceReturn
+	ips       []gandi.IPReturn
+	vlans     []gandi.VLANReturn
+	keys      []gandi.SSHKeyReturn
+	dcs       []gandi.DatacenterReturn
+
+	// The virtual machines, disks, interfaces, VLANs and SSH keys shown, as
+	// filtered and grouped
+	tab           int
+	list          []gandi.VMReturn
+	selector      int
+	diskList      []gandi.DiskReturn
+	diskSelector  int
+	ifaceList     []gandi.IfaceReturn
+	ifaceSelector int
+	vlanList      []gandi.VLANReturn
+	vlanSelector  int
+	keyList       []gandi.SSHKeyReturn
+	keySelector   int
+	filter        int // datacenter id, 0 shows all datacenters
+	grouped       bool
+
+	dialog    dialog
+	suspended bool        // while another program uses the terminal
+	pressed   chan string // key presses, applied one after another by applyKeys
+
+	uiTitle      *termui.Par
+	uiRefresh    *termui.Par
+	uiSummary    *termui.Par
+	uiTabs       *termui.Par
+	uiTable      *termui.Table
+	uiOperations *termui.List
+	uiError      *termui.Par
+	uiCommands   *termui.Par
+}
+
+// newApp creates the widgets and lays them out on termui.Body.
+func newApp(refreshInterval, refreshTimeout time.Duration) *app {
+	a := &app{
+		refreshInterval: refreshInterval,
+		refreshTimeout:  refreshTimeout,
+	}
+
+	// Title
+	a.uiTitle = termui.NewPar("Bapu -- Control your Gandi Machines")
+	a.uiTitle.Border = false
+	a.uiTitle.Height = 3
+	a.uiTitle.TextFgColor = termui.ColorMagenta
+
+	// Refresh indicator
+	a.uiRefresh = termui.NewPar("Refreshing...")
+	a.uiRefresh.Border = false
+	a.uiRefresh.Height = 3
+	a.uiRefresh.TextFgColor = termui.ColorWhite
+
+	// Summary
+	a.uiSummary = termui.NewPar("")
+	a.uiSummary.Height = 3
+	a.uiSummary.Border = true
+	a.uiSummary.BorderLabel = "Summary"
+	a.uiSummary.TextFgColor = termui.ColorWhite
+
+	// Tabs
+	a.uiTabs = termui.NewPar("")
+	a.uiTabs.Height = 1
+	a.uiTabs.Border = false
+
+	// List instances
+	a.uiTable = termui.NewTable()
+	a.uiTable.Rows = serverList(a.list, a.selector, a.disks, a.dcs, a.grouped)
+	a.uiTable.FgColor = termui.ColorWhite
+	a.uiTable.BgColor = termui.ColorDefault
+	a.uiTable.TextAlign = termui.AlignCenter
+	a.uiTable.Seperator = false
+	a.uiTable.Analysis()
+	a.uiTable.SetSize()
+	a.uiTable.BgColors[0] = termui.ColorWhite
+	a.uiTable.FgColors[0] = termui.ColorBlack
+	a.uiTable.Y = 20
+	a.uiTable.X = 0
+	a.uiTable.Border = false
+
+	// Operations launched from the UI
+	a.uiOperations = termui.NewList()
+	a.uiOperations.Height = maxOperations + 2
+	a.uiOperations.BorderLabel = "Operations"
+	a.uiOperations.ItemFgColor = termui.ColorWhite
+
+	// Commands
+	a.uiCommands = termui.NewPar("")
+	a.uiCommands.Height = 3
+	a.uiCommands.Border = false
+	a.uiCommands.BorderLabel = "Summary"
+	a.uiCommands.TextFgColor = termui.ColorBlack
+	a.uiCommands.TextBgColor = termui.ColorWhite
+
+	// Errors
+	a.uiError = termui.NewPar("")
+	a.uiError.Height = 1
+	a.uiError.Border = false
+	a.uiError.TextFgColor = termui.ColorWhite | termui.AttrBold
+	a.uiError.TextBgColor = termui.ColorRed
+
+	// Create termui Grid system
+	termui.Body.AddRows(
+		termui.NewRow(
+			termui.NewCol(8, 0, a.uiTitle),
+			termui.NewCol(4, 0, a.uiRefresh),
+		),
+		termui.NewRow(
+			termui.NewCol(12, 0, a.uiSummary),
+		),
+		termui.NewRow(
+			termui.NewCol(12, 0, a.uiTabs),
+		),
+		termui.NewRow(
+			termui.NewCol(12, 0, a.uiTable),
+		),
+		termui.NewRow(
+			termui.NewCol(12, 0, a.uiOperations),
+		),
+		termui.NewRow(
+			termui.NewCol(12, 0, a.uiError),
+		),
+		termui.NewRow(
+			termui.NewCol(12, 0, a.uiCommands),
+		),
+	)
+
+	return a
+}
+
+// render draws the body and, if open, the dialog on top of it. Nothing is
+// drawn while the UI is suspended. The caller must hold the lock.
+func (a *app) render() {
+	if a.suspended {
+		return
+	}
+	if a.dialog != nil {
+		termui.Render(termui.Body, a.dialog)
+		return
+	}
+
+	termui.Render(termui.Body)
+}
+
+// suspend hands the terminal over to run, which is called without the lock,
+// and restores the UI afterwards, showing errors prefixed with label.
+func (a *app) suspend(label string, run func() error) {
+	a.Lock()
+	a.suspended = true
+	termui.Close()
+	a.Unlock()
+
+	err := run()
+
+	a.Lock()
+	defer a.Unlock()
+
+	// termui.Init would start over with an empty body, hence only termbox
+	// is brought back.
+	if initErr := termbox.Init(); initErr != nil {
+		// The terminal is no longer set up, fatal would hang in termui.Close
+		log.Fatal(initErr)
+	}
+	a.suspended = false
+	if err != nil {
+		err = errors.New(label + ": " + err.Error())
+	}
+	showError(a.uiError, err)
+	termui.Body.Width = termui.TermWidth()
+	termui.Body.Align()
+	termui.Clear()
+	a.render()
+}
+
+// connect switches the UI to client, which talks to the API of profile, and
+// starts refreshing in the background. The caller must hold the lock.
+func (a *app) connect(client *gandi.Client, profile Profile) {
+	if a.stop != nil {
+		a.stop()
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	a.stop = cancel
+
+	a.stopConsoleTimers()
+	a.consoles = make(map[int]*consoleTimer)
+
+	a.client = client
+	a.profile = profile
+	a.datacenters = &datacenterCache{client: client}
+	a.refresh = newRefresher(client, a.datacenters, a.refreshInterval, a.refreshTimeout)
+	a.operations = &operationTracker{client: client}
+
+	a.refreshed = time.Time{}
+	a.account = gandi.AccountReturn{}
+	a.vmCount = 0
+	a.vms = nil
+	a.disks = nil
+	a.ifaces = nil
+	a.ips = nil
+	a.vlans = nil
+	a.keys = nil
+	a.dcs = nil
+	a.selector = 0
+	a.diskSelector = 0
+	a.ifaceSelector = 0
+	a.vlanSelector = 0
+	a.keySelector = 0
+	a.filter = 0
+	a.uiOperations.Items = nil
+	a.updateSummary()
+	a.updateTable()
+
+	go a.refresh.Run(ctx)
+	go a.operations.Run(ctx, 2*time.Second)
+}
+
+// updateSummary fills the summary from the last refresh. The caller must
+// hold the lock.
+func (a *app) updateSummary() {
+	a.uiSummary.Text = "Profile: " + a.profile.Name
+	if a.refreshed.IsZero() {
+		return
+	}
+
+	a.uiSummary.Text += "    Owner: " + a.account.FullName + "    Virtual Machines: " + strconv.Itoa(a.vmCount) + "    Remaining Credit: " + strconv.Itoa(a.account.Credits)
+	if consoles := consoleSummary(a.vms, a.consoles); consoles != "" {
+		a.uiSummary.Text += "    Console enabled: " + consoles
+	}
+	if a.filter != 0 {
+		a.uiSummary.Text += "    Datacenter: " + datacenterName(a.dcs, a.filter)
+	}
+	if a.grouped {
+		a.uiSummary.Text += "    Grouped by datacenter"
+	}
+}
+
+// updateTable fills the table with the virtual machines, disks, network
+// interfaces, VLANs or SSH keys, depending on the tab. The caller must hold the lock.
+func (a *app) updateTable() {
+	a.uiTabs.Text = ""
+	for i, name := range tabNames {
+		if i == a.tab {
+			a.uiTabs.Text += " [ " + name + " ](fg-black,bg-white)"
+		} else {
+			a.uiTabs.Text += "   " + name + "  "
+		}
+	}
+	a.uiTabs.Text += "   <Tab> switch"
+	a.uiCommands.Text = commands[a.tab] + "\n" +
+		"View: <[F]ilter> <[G]roup>    <[A]ccount> <[Q]uit>"
+
+	switch a.tab {
+	case tabVMs:
+		a.updateVMs()
+	case tabDisks:
+		a.updateDisks()
+	case tabNetwork:
+		a.updateIfaces()
+	case tabVLANs:
+		a.updateVLANs()
+	case tabKeys:
+		a.updateKeys()
+	}
+
+	a.uiTable.Analysis()
+	a.uiTable.SetSize()
+	termui.Body.Align()
+}
+
+// tableList is a list of one of the types of the gandi package shown in the
+// table.
+type tableList interface {
+	Len() int
+	rowID(i int) int
+	// datacenter returns 0 for types without a datacenter
+	datacenter(i int) int
+}
+
+type (
+	vmTable    []gandi.VMReturn
+	diskTable  []gandi.DiskReturn
+	ifaceTable []gandi.IfaceReturn
+	vlanTable  []gandi.VLANReturn
+	keyTable   []gandi.SSHKeyReturn
+)
+
+func (l vmTable) Len() int                { return len(l) }
+func (l vmTable) rowID(i int) int         { return l[i].ID }
+func (l vmTable) datacenter(i int) int    { return l[i].DatacenterID }
+func (l diskTable) Len() int              { return len(l) }
+func (l diskTable) rowID(i int) int       { return l[i].ID }
+func (l diskTable) datacenter(i int) int  { return l[i].DatacenterID }
+func (l ifaceTable) Len() int             { return len(l) }
+func (l ifaceTable) rowID(i int) int      { return l[i].ID }
+func (l ifaceTable) datacenter(i int) int { return l[i].DatacenterID }
+func (l vlanTable) Len() int              { return len(l) }
+func (l vlanTable) rowID(i int) int       { return l[i].ID }
+func (l vlanTable) datacenter(i int) int  { return l[i].DatacenterID }
+func (l keyTable) Len() int               { return len(l) }
+func (l keyTable) rowID(i int) int        { return l[i].ID }
+func (l keyTable) datacenter(i int) int   { return 0 }
+
+// arrange returns the indices of the elements of all to show in the table:
+// those in the datacenter filtered for, sorted by datacenter if grouped.
+// Elements without a datacenter are neither filtered nor grouped. Along with
+// them, it returns the position of the element with the ID of
+// shown[selector], so that the selection survives changes of the list. The
+// caller must hold the lock.
+func (a *app) arrange(all, shown tableList, selector int) (order []int, _ int) {
+	selected := -1
+	if selector < shown.Len() {
+		selected = shown.rowID(selector)
+	}
+
+	for i := 0; i < all.Len(); i++ {
+		if dc := all.datacenter(i); a.filter == 0 || dc == 0 || dc == a.filter {
+			order = append(order, i)
+		}
+	}
+	if a.grouped {
+		sort.SliceStable(order, func(i, j int) bool {
+			return datacenterName(a.dcs, all.datacenter(order[i])) < datacenterName(a.dcs, all.datacenter(order[j]))
+		})
+	}
+
+	for i, j := range order {
+		if all.rowID(j) == selected {
+			selector = i
+		}
+	}
+	if selector > len(order)-1 {
+		selector = len(order) - 1
+	}
+	if selector < 0 {
+		selector = 0
+	}
+
+	return order, selector
+}
+
+// updateDisks filters and groups the disks and fills the table with them,
+// keeping the selected disk selected. The caller must hold the lock.
+func (a *app) updateDisks() {
+	order, selector := a.arrange(diskTable(a.disks), diskTable(a.diskList), a.diskSelector)
+	a.diskList, a.diskSelector = make([]gandi.DiskReturn, len(order)), selector
+	for i, j := range order {
+		a.diskList[i] = a.disks[j]
+	}
+
+	a.uiTable.Rows = diskList(a.diskList, a.diskSelector, a.vms, a.dcs, a.grouped)
+	colorDiskRows(a.uiTable, a.diskList)
+}
+
+// updateIfaces filters and groups the network interfaces and fills the
+// table with them, keeping the selected interface selected. The caller must
+// hold the lock.
+func (a *app) updateIfaces() {
+	order, selector := a.arrange(ifaceTable(a.ifaces), ifaceTable(a.ifaceList), a.ifaceSelector)
+	a.ifaceList, a.ifaceSelector = make([]gandi.IfaceReturn, len(order)), selector
+	for i, j := range order {
+		a.ifaceList[i] = a.ifaces[j]
+	}
+
+	a.uiTable.Rows = ifaceRows(a.ifaceList, a.ifaceSelector, a.ips, a.vms, a.dcs, a.grouped)
+	colorIfaceRows(a.uiTable, a.ifaceList)
+}
+
+// updateVLANs filters and groups the private VLANs and fills the table with
+// them, keeping the selected VLAN selected. The caller must hold the lock.
+func (a *app) updateVLANs() {
+	order, selector := a.arrange(vlanTable(a.vlans), vlanTable(a.vlanList), a.vlanSelector)
+	a.vlanList, a.vlanSelector = make([]gandi.VLANReturn, len(order)), selector
+	for i, j := range order {
+		a.vlanList[i] = a.vlans[j]
+	}
+
+	a.uiTable.Rows = vlanRows(a.vlanList, a.vlanSelector, a.ifaces, a.dcs, a.grouped)
+	colorVLANRows(a.uiTable, a.vlanList)
+}
+
+// updateKeys fills the table with the SSH keys, keeping the selected key
+// selected. Keys belong to no datacenter, hence they are neither filtered
+// nor grouped. The caller must hold the lock.
+func (a *app) updateKeys() {
+	order, selector := a.arrange(keyTable(a.keys), keyTable(a.keyList), a.keySelector)
+	a.keyList, a.keySelector = make([]gandi.SSHKeyReturn, len(order)), selector
+	for i, j := range order {
+		a.keyList[i] = a.keys[j]
+	}
+
+	a.uiTable.Rows = keyRows(a.keyList, a.keySelector)
+	colorKeyRows(a.uiTable, a.keyList)
+}
+
+// updateVMs filters and groups the virtual machines and fills the table
+// with them, keeping the selected machine selected. The caller must hold
+// the lock.
+func (a *app) updateVMs() {
+	order, selector := a.arrange(vmTable(a.vms), vmTable(a.list), a.selector)
+	a.list, a.selector = make([]gandi.VMReturn, len(order)), selector
+	for i, j := range order {
+		a.list[i] = a.vms[j]
+	}
+
+	a.uiTable.Rows = serverList(a.list, a.selector, a.disks, a.dcs, a.grouped)
+	colorRows(a.uiTable, a.list)
+}
+
+// handleRefreshStart processes evtRefreshStart.
+func (a *app) handleRefreshStart(e termui.Event) {
+	a.Lock()
+	defer a.Unlock()
+
+	a.uiRefresh.Text = "Refreshing..."
+	a.render()
+}
+
+// handleRefreshDone processes evtRefreshDone.
+func (a *app) handleRefreshDone(e termui.Event) {
+	a.Lock()
+	defer a.Unlock()
+
+	s := e.Data.(snapshot)
+	if s.Source != a.refresh {
+		// Left over from a previous profile
+		return
+	}
+
+	// Resources which could not be fetched keep their previous state
+	a.uiRefresh.Text = "Last refreshed " + s.Time.Format("15:04:05")
+	if err := s.Error(); err != nil {
+		a.uiRefresh.Text = "Refresh incomplete " + s.Time.Format("15:04:05")
+		if s.Err != nil {
+			a.uiRefresh.Text = "Refresh failed " + s.Time.Format("15:04:05")
+		}
+		showError(a.uiError, err)
+	}
+	if s.Err != nil {
+		a.render()
+		return
+	}
+
+	if s.Fetched(resAccount) {
+		a.refreshed = s.Time
+		a.account = s.Info
+	}
+	if s.Fetched(resVMCount) {
+		a.vmCount = s.VMCount
+	}
+	if s.Fetched(resVMs) {
+		a.vms = s.VMs
+	}
+	if s.Fetched(resDisks) {
+		a.disks = s.Disks
+	}
+	if s.Fetched(resIfaces) {
+		a.ifaces = s.Ifaces
+	}
+	if s.Fetched(resIPs) {
+		a.ips = s.IPs
+	}
+	if s.Fetched(resVLANs) {
+		a.vlans = s.VLANs
+	}
+	if s.Fetched(resKeys) {
+		a.keys = s.Keys
+	}
+	if s.Fetched(resDatacenters) {
+		a.dcs = s.Datacenters
+	}
+	a.updateSummary()
+	a.updateTable()
+	a.render()
+}
+
+// handleOperations processes evtOperations.
+func (a *app) handleOperations(e termui.Event) {
+	a.Lock()
+	defer a.Unlock()
+
+	p := e.Data.(operationPoll)
+	if p.Source != a.operations {
+		// Left over from a previous profile
+		return
+	}
+	if p.Err != nil {
+		showError(a.uiError, p.Err)
+	}
+	if p.Finished {
+		a.refresh.Trigger()
+	}
+	a.uiOperations.Items = a.operations.Rows()
+	a.render()
+}
+
+// handleTimer keeps the layout in line with the terminal size.
+func (a *app) handleTimer(e termui.Event) {
+	t := e.Data.(termui.EvtTimer)
+	// t is a EvtTimer
+	if t.Count%2 == 0 {
+		a.Lock()
+		defer a.Unlock()
+
+		termui.Body.Align()
+		a.render()
+	}
+}
+
+// queueKey passes a key press on to applyKeys. termui calls every handler
+// on a goroutine of its own, so key presses handled right there could
+// overtake each other, e.g. while typing into a prompt.
+func (a *app) queueKey(e termui.Event) {
+	a.pressed <- e.Data.(termui.EvtKbd).KeyStr
+}
+
+// applyKeys handles the queued key presses in the order they were queued.
+func (a *app) applyKeys() {
+	for key := range a.pressed {
+		a.handleKey(key)
+	}
+}
+
+// handleKey dispatches key presses to the open dialog or the commands of
+// the main screen.
+func (a *app) handleKey(key string) {
+	a.Lock()
+	if d := a.dialog; d != nil {
+		// The dialog may open another one when it is done
+		if d.HandleKey(key) {
+			if a.dialog == d {
+				a.dialog = nil
+			}
+			termui.Clear()
+		}
+		a.render()
+		a.Unlock()
+		return
+	}
+	a.Unlock()
+
+	switch key {
+	case "q":
+		termui.StopLoop()
+	case "<escape>":
+		// Dismiss the last error
+		a.Lock()
+		showError(a.uiError, nil)
+		a.render()
+		a.Unlock()
+	case "<up>", "<down>":
+		a.Lock()
+		selector, n := &a.selector, len(a.list)
+		switch a.tab {
+		case tabDisks:
+			selector, n = &a.diskSelector, len(a.diskList)
+		case tabNetwork:
+			selector, n = &a.ifaceSelector, len(a.ifaceList)
+		case tabVLANs:
+			selector, n = &a.vlanSelector, len(a.vlanList)
+		case tabKeys:
+			selector, n = &a.keySelector, len(a.keyList)
+		}
+		if key == "<up>" && *selector > 0 {
+			*selector--
+		}
+		if key == "<down>" && *selector < n-1 {
+			*selector++
+		}
+		a.updateTable()
+		a.render()
+		a.Unlock()
+	case "<tab>":
+		a.Lock()
+		a.tab = (a.tab + 1) % len(tabNames)
+		a.updateTable()
+		termui.Clear()
+		a.render()
+		a.Unlock()
+	case "f":
+		a.chooseFilter()
+	case "g":
+		a.Lock()
+		a.grouped = !a.grouped
+		a.updateSummary()
+		a.updateTable()
+		a.render()
+		a.Unlock()
+	case "a":
+		a.chooseProfile()
+	default:
+		a.Lock()
+		tab := a.tab
+		a.Unlock()
+
+		switch tab {
+		case tabVMs:
+			a.handleVMKey(key)
+		case tabDisks:
+			a.handleDiskKey(key)
+		case tabNetwork:
+			a.handleIfaceKey(key)
+		case tabVLANs:
+			a.handleVLANKey(key)
+		case tabKeys:
+			a.handleKeyKey(key)
+		}
+	}
+}
+
+// handleVMKey processes the key presses of the virtual machine tab.
+func (a *app) handleVMKey(key string) {
+	switch key {
+	case "s":
+		a.vmAction(func(c *gandi.Client, id int) (gandi.OperationReturn, error) {
+			return c.VMStart(id)
+		})
+	case "o":
+		a.vmAction(func(c *gandi.Client, id int) (gandi.OperationReturn, error) {
+			return c.VMStop(id)
+		})
+	case "r":
+		a.vmAction(func(c *gandi.Client, id int) (gandi.OperationReturn, error) {
+			return c.VMReboot(id)
+		})
+	case "<enter>":
+		a.showDetails()
+	case "c":
+		a.createVM()
+	case "d":
+		a.deleteVM()
+	case "e":
+		a.resizeVM()
+	case "m":
+		a.migrateVM()
+	case "k":
+		a.chooseBootKernel()
+	case "h":
+		a.sshVM()
+	case "n":
+		a.console()
+	}
+}
+
+// showDetails fetches the selected virtual machine via hosting.vm.info and
+// opens a dialog with everything known about it.
+func (a *app) showDetails() {
+	a.Lock()
+	if len(a.list) == 0 {
+		a.Unlock()
+		return
+	}
+	client := a.client
+	id := a.list[a.selector].ID
+	a.Unlock()
+
+	vm, err := client.VMInfo(id)
+
+	a.Lock()
+	defer a.Unlock()
+
+	showError(a.uiError, err)
+	if err == nil {
+		v := newViewer(vm.Hostname, vmDetails(vm, datacenterName(a.dcs, vm.DatacenterID)))
+		// Called from handleKey with the lock held
+		v.addAction("t", "attach disk", func() { a.chooseDiskFor(vm) })
+		v.addAction("x", "detach disk", func() { a.chooseDiskOf(vm) })
+		a.dialog = v
+	}
+	a.render()
+}
+
+// vmAction runs action on the selected virtual machine and tracks the
+// operation it returns.
+func (a *app) vmAction(action func(c *gandi.Client, id int) (gandi.OperationReturn, error)) {
+	a.Lock()
+	if len(a.list) == 0 {
+		a.Unlock()
+		return
+	}
+	client := a.client
+	vm := a.list[a.selector]
+	a.Unlock()
+
+	op, err := action(client, vm.ID)
+	a.track(client, vm.Hostname, op, err, nil)
+}
+
+// track starts tracking op, labelled with label, as returned by a call via
+// client along with err. then is passed on to AddThen. Errors are shown
+// instead, and operations of a client which is no longer in use ignored.
+func (a *app) track(client *gandi.Client, label string, op gandi.OperationReturn, err error, then func(op gandi.OperationReturn)) {
+	a.Lock()
+	defer a.Unlock()
+
+	showError(a.uiError, err)
+	if err == nil && client == a.client {
+		a.operations.AddThen(label, op, then)
+		a.uiOperations.Items = a.operations.Rows()
+		a.refresh.Trigger()
+	}
+	a.render()
+}
+
+// chooseFilter opens a dialog to show the virtual machines of a single
+// datacenter or of all.
+func (a *app) chooseFilter() {
+	a.Lock()
+	defer a.Unlock()
+
+	// A refresh may replace a.dcs while the dialog is open
+	dcs := append([]gandi.DatacenterReturn(nil), a.dcs...)
+	names := []string{"All datacenters"}
+	for _, dc := range dcs {
+		names = append(names, datacenterName(dcs, dc.ID))
+	}
+
+	a.dialog = newChooser("Show datacenter", names, func(i int) {
+		// Called from handleKey with the lock held
+		a.filter = 0
+		if i > 0 {
+			a.filter = dcs[i-1].ID
+		}
+		a.updateSummary()
+		a.updateTable()
+	})
+	a.render()
+}
+
+// chooseProfile opens a dialog to switch to another profile of the
+// configuration file.
+func (a *app) chooseProfile() {
+	a.Lock()
+	defer a.Unlock()
+
+	err := readConfig()
+	if err != nil {
+		showError(a.uiError, err)
+		a.render()
+		return
+	}
+
+	profiles := Profiles()
+	var names []string
+	for _, p := range profiles {
+		name := p.Name
+		if p.Name == a.profile.Name {
+			name += " (current)"
+		}
+		names = append(names, name)
+	}
+
+	a.dialog = newChooser("Profile", names, func(i int) {
+		// Called from handleKey with the lock held
+		go a.switchProfile(profiles[i])
+	})
+	a.render()
+}
+
+// switchProfile connects to the API of profile and switches the UI to it.
+// Running apiKeyCommand may prompt for a passphrase, so the terminal is
+// handed over to it meanwhile.
+func (a *app) switchProfile(profile Profile) {
+	var apiKey string
+	var err error
+	if profile.KeyCommand != "" {
+		a.suspend("profile "+profile.Name, func() error {
+			fmt.Printf("Running %s, bapu resumes once it is done.\n", profile.KeyCommand)
+			apiKey, err = profile.APIKey()
+			return err
+		})
+		if err != nil {
+			return
+		}
+	} else {
+		apiKey, err = profile.APIKey()
+	}
+
+	var client *gandi.Client
+	if err == nil {
+		client, err = profile.Client(apiKey)
+	}
+
+	a.Lock()
+	defer a.Unlock()
+
+	showError(a.uiError, err)
+	if err == nil {
+		a.connect(client, profile)
+	}
+	a.render()
+}
+
+// run registers the event handlers and runs the event loop until the user
+// quits.
+func (a *app) run() {
+	a.pressed = make(chan string, 64)
+	go a.applyKeys()
+
+	termui.Handle(evtRefreshStart, a.handleRefreshStart)
+	termui.Handle(evtRefreshDone, a.handleRefreshDone)
+	termui.Handle(evtOperations, a.handleOperations)
+	termui.Handle("/sys/kbd", a.queueKey)
+	termui.Handle("/timer/1s", a.handleTimer)
+
+	a.Lock()
+	termui.Body.Align()
+	a.render()
+	a.Unlock()
+
+	termui.Loop()
+
+	a.Lock()
+	a.stop()
+	a.Unlock()
+}
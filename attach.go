@@ -0,0 +1,163 @@
+// Copyright 2017, Carlo Strub <cs@carlostrub.ch>
+// BSD 3-Clause License, see LICENSE file for details.
+
+package main
+
+import (
+	"fmt"
+	"strconv"
+
+	"cost.li/bapu/gandi"
+)
+
+// chooseDiskFor offers the disks which can be attached to vm: those not
+// attached to any machine and in the same datacenter, except snapshots. The
+// caller must hold the lock.
+func (a *app) chooseDiskFor(vm gandi.VMReturn) {
+	var candidates []gandi.DiskReturn
+	var names []string
+	for _, disk := range a.disks {
+		if len(disk.VMsID) == 0 && disk.Type != "snapshot" && disk.State == "created" && disk.DatacenterID == vm.DatacenterID {
+			candidates = append(candidates, disk)
+			names = append(names, fmt.Sprintf("%s (%dMB)", disk.Name, disk.Size))
+		}
+	}
+	if len(candidates) == 0 {
+		showError(a.uiError, fmt.Errorf("no detached disk in %s to attach to %s", datacenterName(a.dcs, vm.DatacenterID), vm.Hostname))
+		return
+	}
+
+	client := a.client
+	a.dialog = newChooser("Attach to "+vm.Hostname, names, func(i int) {
+		go a.attachDisk(client, vm.ID, candidates[i])
+	})
+}
+
+// chooseVMFor offers the virtual machines disk can be attached to: those in
+// the same datacenter. The caller must hold the lock.
+func (a *app) chooseVMFor(disk gandi.DiskReturn) {
+	if len(disk.VMsID) > 0 {
+		showError(a.uiError, fmt.Errorf("%s is attached to %s already, detach it first", disk.Name, attachedTo(disk, a.vms)))
+		return
+	}
+	if disk.Type == "snapshot" {
+		showError(a.uiError, fmt.Errorf("%s is a snapshot, roll %s back to it instead", disk.Name, diskName(a.disks, disk.Source)))
+		return
+	}
+
+	var candidates []gandi.VMReturn
+	var names []string
+	for _, vm := range a.vms {
+		if vm.State != "deleted" && vm.DatacenterID == disk.DatacenterID {
+			candidates = append(candidates, vm)
+			names = append(names, vm.Hostname+" ("+vm.State+")")
+		}
+	}
+	if len(candidates) == 0 {
+		showError(a.uiError, fmt.Errorf("no virtual machine in %s to attach %s to", datacenterName(a.dcs, disk.DatacenterID), disk.Name))
+		return
+	}
+
+	client := a.client
+	a.dialog = newChooser("Attach "+disk.Name+" to", names, func(i int) {
+		go a.attachDisk(client, candidates[i].ID, disk)
+	})
+}
+
+// attachDisk asks for the position to attach disk at among the disks of
+// the virtual machine with the given id and attaches it.
+func (a *app) attachDisk(client *gandi.Client, vmID int, disk gandi.DiskReturn) {
+	vm, err := client.VMInfo(vmID)
+	if err == nil && vm.DatacenterID != disk.DatacenterID {
+		err = fmt.Errorf("%s and %s are in different datacenters", disk.Name, vm.Hostname)
+	}
+
+	a.Lock()
+	defer a.Unlock()
+
+	showError(a.uiError, err)
+	if err != nil || client != a.client || a.dialog != nil {
+		a.render()
+		return
+	}
+
+	var positions []string
+	for i := 0; i <= len(vm.Disks); i++ {
+		position := strconv.Itoa(i)
+		if i == 0 {
+			position += " boot disk"
+		}
+		if i < len(vm.Disks) {
+			position += ", before " + vm.Disks[i].Name
+		} else {
+			position += ", after all other disks"
+		}
+		positions = append(positions, position)
+	}
+
+	c := newChooser("Position of "+disk.Name+" on "+vm.Hostname, positions, func(i int) {
+		go func() {
+			op, err := client.VMDiskAttach(vm.ID, disk.ID, i)
+			a.track(client, disk.Name+" to "+vm.Hostname, op, err, nil)
+		}()
+	})
+	c.Select(len(vm.Disks))
+	a.dialog = c
+	a.render()
+}
+
+// confirmDetach asks whether to detach disk from vm and does so. The caller
+// must hold the lock.
+func (a *app) confirmDetach(vm gandi.VMReturn, disk gandi.DiskReturn) {
+	lines := []string{disk.Name + " is detached from " + vm.Hostname + " and kept."}
+	if disk.IsBootDisk {
+		lines = append(lines, "It is the boot disk: "+vm.Hostname+" has to be halted and cannot start without one.")
+	}
+
+	client := a.client
+	a.dialog = newConfirmation("Detach "+disk.Name, lines, func() {
+		go func() {
+			op, err := client.VMDiskDetach(vm.ID, disk.ID)
+			a.track(client, disk.Name+" from "+vm.Hostname, op, err, nil)
+		}()
+	})
+}
+
+// chooseDiskOf offers the disks attached to vm to detach one. The caller
+// must hold the lock.
+func (a *app) chooseDiskOf(vm gandi.VMReturn) {
+	if len(vm.Disks) == 0 {
+		showError(a.uiError, fmt.Errorf("%s has no disks", vm.Hostname))
+		return
+	}
+
+	var names []string
+	for _, disk := range vm.Disks {
+		names = append(names, fmt.Sprintf("%s (%dMB)", disk.Name, disk.Size))
+	}
+
+	a.dialog = newChooser("Detach from "+vm.Hostname, names, func(i int) {
+		a.confirmDetach(vm, vm.Disks[i])
+	})
+}
+
+// detachDisk detaches the selected disk of the disk tab from its virtual
+// machine.
+func (a *app) detachDisk() {
+	a.Lock()
+	defer a.Unlock()
+
+	disk, ok := a.selectedDisk()
+	if !ok {
+		return
+	}
+	if len(disk.VMsID) == 0 {
+		showError(a.uiError, fmt.Errorf("%s is not attached", disk.Name))
+		a.render()
+		return
+	}
+
+	vm := gandi.VMReturn{ID: disk.VMsID[0], Hostname: vmName(a.vms, disk.VMsID[0])}
+	a.confirmDetach(vm, disk)
+	a.render()
+}
@@ -0,0 +1,250 @@
+// Copyright 2017, Carlo Strub <cs@carlostrub.ch>
+// BSD 3-Clause License, see LICENSE file for details.
+
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"cost.li/bapu/gandi"
+)
+
+// cliOptions holds the command line options of the subcommands.
+type cliOptions struct {
+	Wait     bool   // for operations to finish
+	Output   string // format of listings, see outputFormats
+	Template string // text/template for the template format
+}
+
+// cliCommand is a subcommand of bapu, run instead of the terminal UI.
+type cliCommand struct {
+	Name    string // words following bapu, such as "vm list"
+	Args    string // the arguments, for the usage
+	Help    string
+	MinArgs int
+	MaxArgs int // -1 for any number
+	Run     func(client *gandi.Client, args []string, opts cliOptions) error
+}
+
+// cliCommands are the subcommands of bapu.
+var cliCommands = []cliCommand{
+	{Name: "account info", Help: "show the account and its credits", Run: cliAccountInfo},
+	{Name: "disk list", Help: "list the disks", Run: cliDiskList},
+	{Name: "ip list", Help: "list the IP addresses", Run: cliIPList},
+	{Name: "vm list", Help: "list the virtual machines", Run: cliVMList},
+	{Name: "vm start", Args: "<hostname>...", Help: "start virtual machines", MinArgs: 1, MaxArgs: -1, Run: cliVMAction("start", (*gandi.Client).VMStart)},
+	{Name: "vm stop", Args: "<hostname>...", Help: "stop virtual machines", MinArgs: 1, MaxArgs: -1, Run: cliVMAction("stop", (*gandi.Client).VMStop)},
+	{Name: "vm reboot", Args: "<hostname>...", Help: "reboot virtual machines", MinArgs: 1, MaxArgs: -1, Run: cliVMAction("reboot", (*gandi.Client).VMReboot)},
+}
+
+// pollInterval is how often --wait asks for the state of operations.
+const pollInterval = 2 * time.Second
+
+// findCommand returns the subcommand args start with, along with its
+// arguments.
+func findCommand(args []string) (cliCommand, []string, error) {
+	for _, cmd := range cliCommands {
+		words := strings.Fields(cmd.Name)
+		if len(args) < len(words) || strings.Join(args[:len(words)], " ") != cmd.Name {
+			continue
+		}
+
+		rest := args[len(words):]
+		switch {
+		case len(rest) < cmd.MinArgs:
+			return cmd, nil, fmt.Errorf("%s needs %s", cmd.Name, cmd.Args)
+		case cmd.MaxArgs >= 0 && len(rest) > cmd.MaxArgs:
+			return cmd, nil, fmt.Errorf("%s takes no more than %d arguments", cmd.Name, cmd.MaxArgs)
+		}
+		return cmd, rest, nil
+	}
+
+	return cliCommand{}, nil, fmt.Errorf("unknown command %q", strings.Join(args, " "))
+}
+
+// printCommands writes the subcommands and what they do to w.
+func printCommands(w io.Writer) {
+	tw := tabwriter.NewWriter(w, 0, 8, 2, ' ', 0)
+	for _, cmd := range cliCommands {
+		fmt.Fprintf(tw, "  %s %s\t%s\n", cmd.Name, cmd.Args, cmd.Help)
+	}
+	tw.Flush()
+}
+
+// printTable writes rows as aligned columns to w.
+func printTable(w io.Writer, rows [][]string) error {
+	tw := tabwriter.NewWriter(w, 0, 8, 2, ' ', 0)
+	for _, row := range rows {
+		fmt.Fprintln(tw, strings.Join(row, "\t"))
+	}
+
+	return tw.Flush()
+}
+
+// unselected returns the rows of a table of the terminal UI without the
+// column marking the selected row.
+func unselected(rows [][]string) [][]string {
+	for i := range rows {
+		rows[i] = rows[i][1:]
+	}
+
+	return rows
+}
+
+func cliAccountInfo(client *gandi.Client, args []string, opts cliOptions) error {
+	info, err := client.AccountInfo()
+	if err != nil {
+		return err
+	}
+
+	return printListing(os.Stdout, opts, info, [][]string{
+		{"Owner:", info.FullName},
+		{"Handle:", info.Handle},
+		{"Credits:", fmt.Sprintf("%d (expiring %s)", info.Credits, info.DateCreditsExpiration.Format(dateFormat))},
+		{"Average cost:", fmt.Sprintf("%.2f credits per hour", info.AverageCreditCost)},
+		{"Billing day:", fmt.Sprintf("%d", info.CycleDay)},
+	})
+}
+
+func cliVMList(client *gandi.Client, args []string, opts cliOptions) error {
+	vms, err := client.VMList()
+	if err != nil {
+		return err
+	}
+	disks, err := client.DiskList()
+	if err != nil {
+		return err
+	}
+	dcs, err := (&datacenterCache{client: client}).List()
+	if err != nil {
+		return err
+	}
+
+	return printListing(os.Stdout, opts, vms, unselected(serverList(vms, -1, disks, dcs, false)))
+}
+
+func cliDiskList(client *gandi.Client, args []string, opts cliOptions) error {
+	disks, err := client.DiskList()
+	if err != nil {
+		return err
+	}
+	vms, err := client.VMList()
+	if err != nil {
+		return err
+	}
+	dcs, err := (&datacenterCache{client: client}).List()
+	if err != nil {
+		return err
+	}
+
+	return printListing(os.Stdout, opts, disks, unselected(diskList(disks, -1, vms, dcs, false)))
+}
+
+func cliIPList(client *gandi.Client, args []string, opts cliOptions) error {
+	ips, err := client.IPList()
+	if err != nil {
+		return err
+	}
+	ifaces, err := client.IfaceList()
+	if err != nil {
+		return err
+	}
+	vms, err := client.VMList()
+	if err != nil {
+		return err
+	}
+	dcs, err := (&datacenterCache{client: client}).List()
+	if err != nil {
+		return err
+	}
+
+	rows := [][]string{{"IP", "Version", "Reverse DNS", "Attached to", "Datacenter", "State"}}
+	for _, ip := range ips {
+		vm := "-"
+		for _, iface := range ifaces {
+			if iface.ID == ip.IfaceID && iface.VMID != 0 {
+				vm = fmt.Sprintf("%s #%d", vmName(vms, iface.VMID), iface.Num)
+			}
+		}
+		reverse := ip.Reverse
+		if reverse == "" {
+			reverse = "-"
+		}
+		rows = append(rows, []string{
+			ip.IP,
+			fmt.Sprintf("IPv%d", ip.Version),
+			reverse,
+			vm,
+			datacenterName(dcs, ip.DatacenterID),
+			ip.State,
+		})
+	}
+
+	return printListing(os.Stdout, opts, ips, rows)
+}
+
+// cliVMAction returns a subcommand running action, described by verb, on the
+// virtual machines named by its arguments.
+func cliVMAction(verb string, action func(c *gandi.Client, id int) (gandi.OperationReturn, error)) func(*gandi.Client, []string, cliOptions) error {
+	return func(client *gandi.Client, args []string, opts cliOptions) error {
+		vms, err := client.VMList()
+		if err != nil {
+			return err
+		}
+
+		// Look all of them up first, so that a typo does not leave the
+		// others half done
+		var targets []gandi.VMReturn
+		for _, hostname := range args {
+			found := false
+			for _, vm := range vms {
+				if vm.Hostname == hostname {
+					targets = append(targets, vm)
+					found = true
+				}
+			}
+			if !found {
+				return fmt.Errorf("no virtual machine named %s", hostname)
+			}
+		}
+
+		var ops []gandi.OperationReturn
+		for _, vm := range targets {
+			op, err := action(client, vm.ID)
+			if err != nil {
+				return fmt.Errorf("%s %s: %v", verb, vm.Hostname, err)
+			}
+			fmt.Printf("%s: %s operation %d %s\n", vm.Hostname, op.Type, op.ID, op.Step)
+			ops = append(ops, op)
+		}
+		if !opts.Wait {
+			return nil
+		}
+
+		failed := 0
+		for i, op := range ops {
+			for !op.Finished() {
+				time.Sleep(pollInterval)
+				op, err = client.OperationInfo(op.ID)
+				if err != nil {
+					return err
+				}
+			}
+			fmt.Printf("%s: %s operation %d %s\n", targets[i].Hostname, op.Type, op.ID, op.Step)
+			if op.Step != gandi.StepDone {
+				fmt.Fprintf(os.Stderr, "%s: %s\n", targets[i].Hostname, op.LastError)
+				failed++
+			}
+		}
+		if failed > 0 {
+			return fmt.Errorf("%d of %d operations failed", failed, len(ops))
+		}
+
+		return nil
+	}
+}
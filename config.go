@@ -0,0 +1,197 @@
+// Copyright 2017, Carlo Strub <cs@carlostrub.ch>
+// BSD 3-Clause License, see LICENSE file for details.
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+
+	"cost.li/bapu/gandi"
+	"cost.li/bapu/gandi/fake"
+	"github.com/spf13/viper"
+)
+
+// Profile is a Gandi account in a given environment, as configured in
+// bapu.toml. Profiles are defined as [profile.<name>] tables; the sections
+// [production], [development] and [local] are profiles named after their
+// section.
+type Profile struct {
+	Name     string
+	Endpoint string
+	Enabled  bool // candidate for the default profile, see defaultProfile
+
+	// Sources of the API key, see APIKey
+	Key        string
+	KeyEnv     string
+	KeyCommand string
+	KeyFile    string
+}
+
+// legacyProfiles are the top level sections that define a profile, with
+// the endpoint they use by default.
+var legacyProfiles = map[string]string{
+	"production":  "production",
+	"development": "development",
+	"local":       "local",
+}
+
+// demoEndpoint is the URL of the fake served for local profiles without
+// endpoint, so that all of them share the same demo account.
+var (
+	demoEndpoint     string
+	demoEndpointOnce sync.Once
+	demoEndpointErr  error
+)
+
+// bapu.toml is looked for in the home directory, /usr/local/etc and /etc
+func init() {
+	viper.SetConfigName("bapu")
+	viper.AddConfigPath(os.Getenv("HOME"))
+	viper.AddConfigPath("/usr/local/etc")
+	viper.AddConfigPath("/etc")
+}
+
+// readConfig reads bapu.toml, again if it was read before.
+func readConfig() error {
+	return viper.ReadInConfig()
+}
+
+// loadProfile returns the profile defined under key in the configuration.
+func loadProfile(name, key, endpoint string) Profile {
+	if viper.IsSet(key + ".endpoint") {
+		endpoint = viper.GetString(key + ".endpoint")
+	}
+
+	return Profile{
+		Name:       name,
+		Endpoint:   endpoint,
+		Enabled:    viper.GetBool(key + ".enabled"),
+		Key:        viper.GetString(key + ".apiKey"),
+		KeyEnv:     viper.GetString(key + ".apiKeyEnv"),
+		KeyCommand: viper.GetString(key + ".apiKeyCommand"),
+		KeyFile:    viper.GetString(key + ".apiKeyFile"),
+	}
+}
+
+// Profiles returns all profiles defined in the configuration, sorted by
+// name.
+func Profiles() (profiles []Profile) {
+	for name, endpoint := range legacyProfiles {
+		if viper.IsSet(name) {
+			profiles = append(profiles, loadProfile(name, name, endpoint))
+		}
+	}
+
+	for name := range viper.GetStringMap("profile") {
+		profiles = append(profiles, loadProfile(name, "profile."+name, "production"))
+	}
+
+	sort.Sort(byName(profiles))
+
+	return profiles
+}
+
+type byName []Profile
+
+func (p byName) Len() int           { return len(p) }
+func (p byName) Swap(i, j int)      { p[i], p[j] = p[j], p[i] }
+func (p byName) Less(i, j int) bool { return p[i].Name < p[j].Name }
+
+// defaultProfile returns the name of the profile to use if none is given on
+// the command line: the one named by defaultProfile in the configuration, or
+// else the only enabled one.
+func defaultProfile(profiles []Profile) (string, error) {
+	if viper.IsSet("defaultProfile") {
+		return viper.GetString("defaultProfile"), nil
+	}
+
+	var enabled []string
+	for _, p := range profiles {
+		if p.Enabled {
+			enabled = append(enabled, p.Name)
+		}
+	}
+
+	switch len(enabled) {
+	case 0:
+		return "", errors.New("no profile enabled in config, enable one or set defaultProfile")
+	case 1:
+		return enabled[0], nil
+	}
+
+	return "", fmt.Errorf("several profiles enabled in config (%s), choose one with --profile or set defaultProfile", strings.Join(enabled, ", "))
+}
+
+// Connect returns a client for the API of the profile.
+func (p Profile) Connect() (*gandi.Client, error) {
+	apiKey, err := p.APIKey()
+	if err != nil {
+		return nil, err
+	}
+
+	return p.Client(apiKey)
+}
+
+// Client returns a Gandi client for the endpoint of the profile, using the
+// already resolved apiKey.
+func (p Profile) Client(apiKey string) (*gandi.Client, error) {
+	url := p.Endpoint
+
+	switch p.Endpoint {
+	case "production":
+		url = gandi.ProductionURL
+	case "development":
+		url = gandi.DevelopmentURL
+	case "local":
+		// Serve the fake from within bapu
+		demoEndpointOnce.Do(func() {
+			demoEndpoint, demoEndpointErr = fake.NewDemoServer().Listen("127.0.0.1:0")
+		})
+		if demoEndpointErr != nil {
+			return nil, demoEndpointErr
+		}
+		url = demoEndpoint
+	}
+
+	return gandi.NewClient(url, apiKey)
+}
+
+// LoadAPI returns a Gandi client according to the profile with the given
+// name as defined in the configuration file. If name is empty, the default
+// profile is used. A profile named explicitly is used even if it is not
+// enabled, as enabled merely picks the default profile.
+func LoadAPI(name string) (client *gandi.Client, profile Profile, err error) {
+	err = readConfig()
+	if err != nil {
+		return client, profile, err
+	}
+
+	profiles := Profiles()
+	if name == "" {
+		name, err = defaultProfile(profiles)
+		if err != nil {
+			return client, profile, err
+		}
+	}
+
+	found := false
+	for _, p := range profiles {
+		if p.Name == strings.ToLower(name) {
+			profile = p
+			found = true
+			break
+		}
+	}
+	if !found {
+		return client, profile, fmt.Errorf("profile %s not found in config", name)
+	}
+
+	client, err = profile.Connect()
+
+	return client, profile, err
+}
@@ -0,0 +1,239 @@
+// Copyright 2017, Carlo Strub <cs@carlostrub.ch>
+// BSD 3-Clause License, see LICENSE file for details.
+
+package main
+
+import (
+	"fmt"
+	"os/exec"
+	"strconv"
+	"strings"
+	"time"
+
+	"cost.li/bapu/gandi"
+	"github.com/spf13/viper"
+)
+
+// defaultConsoleAutoDisable is how long emergency consoles stay enabled
+// unless configured otherwise.
+const defaultConsoleAutoDisable = "30m"
+
+// consoleTimer disables the emergency console of a virtual machine at a
+// given time.
+type consoleTimer struct {
+	*time.Timer
+	At time.Time
+}
+
+// consoleUser returns the user to log into the emergency console of vm with,
+// which is the id of the machine.
+func consoleUser(vm gandi.VMReturn) string {
+	return strconv.Itoa(vm.ID)
+}
+
+// consoleAutoDisable returns after how long emergency consoles are disabled
+// again. Zero keeps them enabled.
+func consoleAutoDisable() time.Duration {
+	viper.SetDefault("console.autoDisable", defaultConsoleAutoDisable)
+
+	d := viper.GetDuration("console.autoDisable")
+	if d < 0 {
+		return 0
+	}
+
+	return d
+}
+
+// consoleCommand returns the command configured to open the emergency
+// console of vm, with {id}, {hostname} and {host} replaced, or nil to open it
+// in this terminal.
+func consoleCommand(vm gandi.VMReturn) []string {
+	replacer := strings.NewReplacer(
+		"{id}", strconv.Itoa(vm.ID),
+		"{hostname}", vm.Hostname,
+		"{host}", vm.ConsoleURL,
+	)
+
+	var args []string
+	for _, arg := range strings.Fields(viper.GetString("console.command")) {
+		args = append(args, replacer.Replace(arg))
+	}
+
+	return args
+}
+
+// consoleSummary returns the hostnames of the virtual machines among vms
+// whose emergency console is enabled, with the time it is disabled at.
+func consoleSummary(vms []gandi.VMReturn, timers map[int]*consoleTimer) string {
+	var names []string
+	for _, vm := range vms {
+		if vm.Console == 0 {
+			continue
+		}
+		name := vm.Hostname
+		if t, ok := timers[vm.ID]; ok {
+			name += " until " + t.At.Format("15:04")
+		}
+		names = append(names, name)
+	}
+
+	return strings.Join(names, ", ")
+}
+
+// stopConsoleTimers cancels all automatic disabling of emergency consoles.
+// The caller must hold the lock.
+func (a *app) stopConsoleTimers() {
+	for id, t := range a.consoles {
+		t.Stop()
+		delete(a.consoles, id)
+	}
+}
+
+// console fetches the selected virtual machine and either offers to enable
+// its emergency console or shows how to reach it.
+func (a *app) console() {
+	a.Lock()
+	if len(a.list) == 0 {
+		a.Unlock()
+		return
+	}
+	client := a.client
+	id := a.list[a.selector].ID
+	a.Unlock()
+
+	vm, err := client.VMInfo(id)
+
+	a.Lock()
+	defer a.Unlock()
+
+	showError(a.uiError, err)
+	if err != nil || client != a.client {
+		a.render()
+		return
+	}
+
+	if vm.Console != 0 {
+		a.dialog = a.consoleViewer(client, vm)
+		a.render()
+		return
+	}
+
+	lines := []string{
+		fmt.Sprintf("The emergency console of %s is enabled. It gives access to", vm.Hostname),
+		"the machine even if its network is down, so disable it once done.",
+	}
+	if d := consoleAutoDisable(); d > 0 {
+		lines = append(lines, fmt.Sprintf("bapu disables it again after %s.", d))
+	} else {
+		lines = append(lines, "It stays enabled until it is disabled with <N> again.")
+	}
+
+	a.dialog = newConfirmation("Enable console of "+vm.Hostname, lines, func() {
+		// Called from handleKey with the lock held
+		go func() {
+			op, err := client.VMConsole(vm.ID, true)
+			a.track(client, vm.Hostname+" console", op, err, func(op gandi.OperationReturn) {
+				if op.Step == gandi.StepDone {
+					a.consoleEnabled(client, vm.ID)
+				}
+			})
+		}()
+	})
+	a.render()
+}
+
+// consoleEnabled schedules the emergency console of the virtual machine with
+// the given id to be disabled again and shows how to reach it.
+func (a *app) consoleEnabled(client *gandi.Client, id int) {
+	vm, err := client.VMInfo(id)
+
+	a.Lock()
+	defer a.Unlock()
+
+	if client != a.client {
+		return
+	}
+	showError(a.uiError, err)
+	if err != nil {
+		a.render()
+		return
+	}
+
+	if d := consoleAutoDisable(); d > 0 {
+		if t, ok := a.consoles[vm.ID]; ok {
+			t.Stop()
+		}
+		a.consoles[vm.ID] = &consoleTimer{
+			Timer: time.AfterFunc(d, func() { a.disableConsole(client, vm) }),
+			At:    time.Now().Add(d),
+		}
+		a.updateSummary()
+	}
+	if a.dialog == nil {
+		a.dialog = a.consoleViewer(client, vm)
+	}
+	a.render()
+}
+
+// consoleViewer returns a dialog telling how to reach the emergency console
+// of vm, with actions to open and to disable it. The caller must hold the
+// lock.
+func (a *app) consoleViewer(client *gandi.Client, vm gandi.VMReturn) *viewer {
+	until := "Remember to disable it with <x> once you are done."
+	if t, ok := a.consoles[vm.ID]; ok {
+		until = "bapu disables it at " + t.At.Format("15:04") + ", or with <x> before."
+	}
+
+	v := newViewer("Console of "+vm.Hostname, []string{
+		fmt.Sprintf("Console:      %s", vm.ConsoleURL),
+		fmt.Sprintf("Connect with: ssh %s@%s", consoleUser(vm), vm.ConsoleURL),
+		"",
+		"Log in with a user and password of the machine, SSH keys are not",
+		"accepted on the console. " + until,
+	})
+	// Called from handleKey with the lock held
+	v.addAction("o", "open", func() { go a.openConsole(vm) })
+	v.addAction("x", "disable", func() { go a.disableConsole(client, vm) })
+
+	return v
+}
+
+// openConsole connects to the emergency console of vm with the configured
+// command, or with ssh in this terminal.
+func (a *app) openConsole(vm gandi.VMReturn) {
+	args := consoleCommand(vm)
+	if len(args) == 0 {
+		a.ssh("console of "+vm.Hostname, consoleUser(vm), vm.ConsoleURL)
+		return
+	}
+
+	cmd := exec.Command(args[0], args[1:]...)
+	err := cmd.Start()
+	if err == nil {
+		// Reap it once it exits
+		go cmd.Wait()
+	}
+
+	a.Lock()
+	defer a.Unlock()
+
+	if err != nil {
+		err = fmt.Errorf("console of %s: %v", vm.Hostname, err)
+	}
+	showError(a.uiError, err)
+	a.render()
+}
+
+// disableConsole disables the emergency console of vm and cancels disabling
+// it automatically.
+func (a *app) disableConsole(client *gandi.Client, vm gandi.VMReturn) {
+	a.Lock()
+	if t, ok := a.consoles[vm.ID]; ok && client == a.client {
+		t.Stop()
+		delete(a.consoles, vm.ID)
+	}
+	a.Unlock()
+
+	op, err := client.VMConsole(vm.ID, false)
+	a.track(client, vm.Hostname+" console", op, err, nil)
+}
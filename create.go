@@ -0,0 +1,238 @@
+// Copyright 2017, Carlo Strub <cs@carlostrub.ch>
+// BSD 3-Clause License, see LICENSE file for details.
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"cost.li/bapu/gandi"
+)
+
+// Defaults offered by the creation wizard
+const (
+	defaultCores    = 1
+	defaultMemory   = 1024  // MB
+	defaultDiskSize = 10240 // MB
+	defaultSSHKey   = "~/.ssh/id_rsa.pub"
+)
+
+var hostnamePattern = regexp.MustCompile(`^[a-zA-Z0-9]([a-zA-Z0-9-]{0,61}[a-zA-Z0-9])?$`)
+
+// intValidator returns a validation function for prompts accepting whole
+// numbers of at least min.
+func intValidator(min int) func(string) error {
+	return func(input string) error {
+		n, err := strconv.Atoi(strings.TrimSpace(input))
+		if err != nil {
+			return errors.New("not a number")
+		}
+		if n < min {
+			return fmt.Errorf("must be at least %d", min)
+		}
+		return nil
+	}
+}
+
+// validateHostname accepts hostnames made of letters, digits and dashes.
+func validateHostname(input string) error {
+	if !hostnamePattern.MatchString(input) {
+		return errors.New("use letters, digits and dashes only")
+	}
+	return nil
+}
+
+// readSSHKey returns the public key stored in the file at path.
+func readSSHKey(path string) (string, error) {
+	if strings.HasPrefix(path, "~/") {
+		path = filepath.Join(os.Getenv("HOME"), path[2:])
+	}
+
+	content, err := ioutil.ReadFile(path)
+	if err != nil {
+		return "", err
+	}
+
+	key := strings.TrimSpace(string(content))
+	if !strings.HasPrefix(key, "ssh-") && !strings.HasPrefix(key, "ecdsa-") {
+		return "", errors.New(path + " does not contain a public SSH key")
+	}
+
+	return key, nil
+}
+
+// createVM opens a wizard asking for everything hosting.vm.create_from
+// needs and creates the virtual machine.
+func (a *app) createVM() {
+	a.Lock()
+	client := a.client
+	cache := a.datacenters
+	a.Unlock()
+
+	datacenters, err := cache.List()
+	images := make(map[int][]gandi.ImageReturn)
+	for _, dc := range datacenters {
+		if err != nil {
+			break
+		}
+		images[dc.ID], err = client.ImageList(dc.ID)
+	}
+
+	a.Lock()
+	defer a.Unlock()
+
+	showError(a.uiError, err)
+	if err != nil {
+		a.render()
+		return
+	}
+	if client != a.client {
+		// The profile was switched meanwhile
+		return
+	}
+
+	var (
+		dc       gandi.DatacenterReturn
+		image    gandi.ImageReturn
+		spec     gandi.VMCreateSpec
+		keyNames []string // of the registered keys chosen
+	)
+	keys := a.keys
+
+	a.dialog = newWizard(
+		func(next func()) dialog {
+			var names []string
+			for _, dc := range datacenters {
+				names = append(names, fmt.Sprintf("%s (%s)", dc.Name, dc.ISO))
+			}
+			return newChooser("Datacenter", names, func(i int) {
+				dc = datacenters[i]
+				spec.DatacenterID = dc.ID
+				next()
+			})
+		},
+		func(next func()) dialog {
+			var names []string
+			for _, image := range images[dc.ID] {
+				names = append(names, fmt.Sprintf("%s (%s, %dMB)", image.Label, image.OSArch, image.Size))
+			}
+			return newChooser("Image in "+dc.Name, names, func(i int) {
+				image = images[dc.ID][i]
+				next()
+			})
+		},
+		func(next func()) dialog {
+			return newPrompt("Cores", "Number of cores", strconv.Itoa(defaultCores), intValidator(1), func(input string) {
+				spec.Cores, _ = strconv.Atoi(strings.TrimSpace(input))
+				next()
+			})
+		},
+		func(next func()) dialog {
+			return newPrompt("Memory", "Memory in MB", strconv.Itoa(defaultMemory), intValidator(256), func(input string) {
+				spec.Memory, _ = strconv.Atoi(strings.TrimSpace(input))
+				next()
+			})
+		},
+		func(next func()) dialog {
+			size := defaultDiskSize
+			if image.Size > size {
+				size = image.Size
+			}
+			return newPrompt("System disk", "Disk size in MB", strconv.Itoa(size), intValidator(image.Size), func(input string) {
+				spec.DiskSize, _ = strconv.Atoi(strings.TrimSpace(input))
+				next()
+			})
+		},
+		func(next func()) dialog {
+			return newPrompt("Hostname", "Hostname", "", validateHostname, func(input string) {
+				spec.Hostname = input
+				spec.DiskName = "sys_" + strings.Replace(input, "-", "_", -1)
+				next()
+			})
+		},
+		func(next func()) dialog {
+			if len(keys) == 0 {
+				return nil
+			}
+			var names []string
+			for _, key := range keys {
+				names = append(names, fmt.Sprintf("%-16s %s", key.Name, key.Fingerprint))
+			}
+			if len(keys) > 1 {
+				names = append(names, "All registered keys")
+			}
+			names = append(names, "Public key file...")
+			return newChooser("SSH key", names, func(i int) {
+				spec.KeyIDs, keyNames = nil, nil
+				for j, key := range keys {
+					if i == j || i == len(keys) && len(keys) > 1 {
+						spec.KeyIDs = append(spec.KeyIDs, key.ID)
+						keyNames = append(keyNames, key.Name)
+					}
+				}
+				next()
+			})
+		},
+		func(next func()) dialog {
+			if len(spec.KeyIDs) > 0 {
+				return nil
+			}
+			validate := func(input string) error {
+				_, err := readSSHKey(input)
+				return err
+			}
+			return newPrompt("SSH key", "Public key file", defaultSSHKey, validate, func(input string) {
+				spec.SSHKey, _ = readSSHKey(input)
+				next()
+			})
+		},
+		func(next func()) dialog {
+			return newChooser("IP version", []string{"IPv4 and IPv6", "IPv6 only"}, func(i int) {
+				spec.IPVersion = 4
+				if i == 1 {
+					spec.IPVersion = 6
+				}
+				next()
+			})
+		},
+		func(next func()) dialog {
+			lines := []string{
+				"Hostname:    " + spec.Hostname,
+				"Datacenter:  " + dc.Name,
+				"Image:       " + image.Label,
+				fmt.Sprintf("Cores:       %d", spec.Cores),
+				fmt.Sprintf("Memory:      %dMB", spec.Memory),
+				fmt.Sprintf("Disk:        %s, %dMB", spec.DiskName, spec.DiskSize),
+				fmt.Sprintf("IP version:  %d", spec.IPVersion),
+			}
+			if len(keyNames) > 0 {
+				lines = append(lines, "SSH keys:    "+strings.Join(keyNames, ", "))
+			}
+			return newConfirmation("Create "+spec.Hostname, lines, func() {
+				next()
+				// Called from handleKey with the lock held
+				go a.submitVM(client, spec, image.DiskID)
+			})
+		},
+	)
+	a.render()
+}
+
+// submitVM calls hosting.vm.create_from and tracks the operations it
+// returns.
+func (a *app) submitVM(client *gandi.Client, spec gandi.VMCreateSpec, srcDiskID int) {
+	ops, err := client.VMCreateFrom(spec, srcDiskID)
+	if err != nil {
+		a.track(client, spec.Hostname, gandi.OperationReturn{}, err, nil)
+	}
+	for _, op := range ops {
+		a.track(client, spec.Hostname, op, nil, nil)
+	}
+}
@@ -0,0 +1,116 @@
+// Copyright 2017, Carlo Strub <cs@carlostrub.ch>
+// BSD 3-Clause License, see LICENSE file for details.
+
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+// APIKey returns the API key of the profile from whichever source is
+// configured: apiKey in cleartext, the environment variable named by
+// apiKeyEnv, the first line printed by apiKeyCommand or the content of
+// apiKeyFile.
+func (p Profile) APIKey() (string, error) {
+	var sources []string
+	if p.Key != "" {
+		sources = append(sources, "apiKey")
+	}
+	if p.KeyEnv != "" {
+		sources = append(sources, "apiKeyEnv")
+	}
+	if p.KeyCommand != "" {
+		sources = append(sources, "apiKeyCommand")
+	}
+	if p.KeyFile != "" {
+		sources = append(sources, "apiKeyFile")
+	}
+
+	switch {
+	case len(sources) == 0:
+		return "", fmt.Errorf("profile %s: no API key configured", p.Name)
+	case len(sources) > 1:
+		return "", fmt.Errorf("profile %s: only one of %s may be configured", p.Name, strings.Join(sources, ", "))
+	}
+
+	var key string
+	var err error
+	switch sources[0] {
+	case "apiKey":
+		key = p.Key
+	case "apiKeyEnv":
+		key = os.Getenv(p.KeyEnv)
+		if key == "" {
+			err = errors.New("environment variable " + p.KeyEnv + " is not set")
+		}
+	case "apiKeyCommand":
+		key, err = keyFromCommand(p.KeyCommand)
+	case "apiKeyFile":
+		key, err = keyFromFile(p.KeyFile)
+	}
+	if err != nil {
+		return "", fmt.Errorf("profile %s: %v", p.Name, err)
+	}
+
+	return key, nil
+}
+
+// keyFromCommand runs command with the shell and returns the first line of
+// its output, the way password managers such as pass print secrets.
+func keyFromCommand(command string) (string, error) {
+	var stderr bytes.Buffer
+
+	cmd := exec.Command("/bin/sh", "-c", command)
+	cmd.Stderr = &stderr
+
+	out, err := cmd.Output()
+	if err != nil {
+		msg := strings.TrimSpace(stderr.String())
+		if msg != "" {
+			return "", fmt.Errorf("%s: %v: %s", command, err, msg)
+		}
+		return "", fmt.Errorf("%s: %v", command, err)
+	}
+
+	key := strings.TrimSpace(strings.SplitN(string(out), "\n", 2)[0])
+	if key == "" {
+		return "", errors.New(command + " printed no API key")
+	}
+
+	return key, nil
+}
+
+// keyFromFile returns the content of the file at path. Files readable by
+// everybody are refused.
+func keyFromFile(path string) (string, error) {
+	if strings.HasPrefix(path, "~/") {
+		path = filepath.Join(os.Getenv("HOME"), path[2:])
+	}
+
+	info, err := os.Stat(path)
+	if err != nil {
+		return "", err
+	}
+	if info.Mode().Perm()&0004 != 0 {
+		return "", fmt.Errorf("%s is world-readable, restrict it with chmod o-r", path)
+	}
+
+	content, err := ioutil.ReadFile(path)
+	if err != nil {
+		return "", err
+	}
+
+	key := strings.TrimSpace(string(content))
+	if key == "" {
+		return "", errors.New(path + " is empty")
+	}
+
+	return key, nil
+}
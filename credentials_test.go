@@ -0,0 +1,120 @@
+// Copyright 2017, Carlo Strub <cs@carlostrub.ch>
+// BSD 3-Clause License, see LICENSE file for details.
+
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// withKeyFiles runs test in a temporary directory serving as $HOME.
+func withKeyFiles(t *testing.T, test func(dir string)) {
+	dir, err := ioutil.TempDir("", "bapu")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	home := os.Getenv("HOME")
+	os.Setenv("HOME", dir)
+	defer os.Setenv("HOME", home)
+
+	test(dir)
+}
+
+// writeKeyFile writes content to the file name in dir with the given mode.
+func writeKeyFile(t *testing.T, dir, name, content string, mode os.FileMode) string {
+	path := filepath.Join(dir, name)
+	if err := ioutil.WriteFile(path, []byte(content), mode); err != nil {
+		t.Fatal(err)
+	}
+	// WriteFile is subject to the umask
+	if err := os.Chmod(path, mode); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestKeyFromFile(t *testing.T) {
+	withKeyFiles(t, func(dir string) {
+		for _, c := range []struct {
+			name    string
+			content string
+			mode    os.FileMode
+			path    string // as configured, the file name in dir if empty
+			key     string
+			err     string // part of the error, empty if the key is read
+		}{
+			{name: "private", content: "secret\n", mode: 0600, key: "secret"},
+			{name: "group", content: "  secret  ", mode: 0640, key: "secret"},
+			{name: "home", content: "secret", mode: 0600, path: "~/home", key: "secret"},
+			{name: "public", content: "secret", mode: 0644, err: "world-readable"},
+			{name: "everybody", content: "secret", mode: 0666, err: "world-readable"},
+			{name: "empty", content: "\n", mode: 0600, err: "is empty"},
+		} {
+			path := writeKeyFile(t, dir, c.name, c.content, c.mode)
+			if c.path != "" {
+				path = c.path
+			}
+
+			key, err := keyFromFile(path)
+			switch {
+			case c.err == "" && (err != nil || key != c.key):
+				t.Errorf("%s: got key %q and error %v, want key %q", c.name, key, err, c.key)
+			case c.err != "" && (err == nil || !strings.Contains(err.Error(), c.err)):
+				t.Errorf("%s: got key %q and error %v, want error with %q", c.name, key, err, c.err)
+			}
+		}
+
+		if _, err := keyFromFile(filepath.Join(dir, "missing")); !os.IsNotExist(err) {
+			t.Errorf("missing file: got error %v", err)
+		}
+	})
+}
+
+func TestAPIKey(t *testing.T) {
+	withKeyFiles(t, func(dir string) {
+		file := writeKeyFile(t, dir, "key", "from file\n", 0600)
+		os.Setenv("BAPU_TEST_KEY", "from env")
+		defer os.Unsetenv("BAPU_TEST_KEY")
+
+		for _, c := range []struct {
+			name    string
+			profile Profile
+			key     string
+			err     string // part of the error, empty if the key is found
+		}{
+			{"apiKey", Profile{Key: "cleartext"}, "cleartext", ""},
+			{"apiKeyEnv", Profile{KeyEnv: "BAPU_TEST_KEY"}, "from env", ""},
+			{"apiKeyCommand", Profile{KeyCommand: "printf 'from command\\nsecond line\\n'"}, "from command", ""},
+			{"apiKeyFile", Profile{KeyFile: file}, "from file", ""},
+			{"none", Profile{}, "", "no API key configured"},
+			{"unset env", Profile{KeyEnv: "BAPU_TEST_UNSET"}, "", "BAPU_TEST_UNSET is not set"},
+			{"failing command", Profile{KeyCommand: "echo locked >&2; exit 1"}, "", "locked"},
+			{"silent command", Profile{KeyCommand: "true"}, "", "printed no API key"},
+			{"key and file", Profile{Key: "cleartext", KeyFile: file}, "", "only one of apiKey, apiKeyFile"},
+			{"env and command", Profile{KeyEnv: "BAPU_TEST_KEY", KeyCommand: "echo key"}, "", "only one of apiKeyEnv, apiKeyCommand"},
+			{
+				"all",
+				Profile{Key: "cleartext", KeyEnv: "BAPU_TEST_KEY", KeyCommand: "echo key", KeyFile: file},
+				"",
+				"only one of apiKey, apiKeyEnv, apiKeyCommand, apiKeyFile",
+			},
+		} {
+			c.profile.Name = "test"
+			key, err := c.profile.APIKey()
+			switch {
+			case c.err == "" && (err != nil || key != c.key):
+				t.Errorf("%s: got key %q and error %v, want key %q", c.name, key, err, c.key)
+			case c.err != "" && (err == nil || !strings.Contains(err.Error(), c.err)):
+				t.Errorf("%s: got key %q and error %v, want error with %q", c.name, key, err, c.err)
+			case c.err != "" && !strings.HasPrefix(err.Error(), "profile test: "):
+				t.Errorf("%s: error %v does not name the profile", c.name, err)
+			}
+		}
+	})
+}
@@ -0,0 +1,62 @@
+// Copyright 2017, Carlo Strub <cs@carlostrub.ch>
+// BSD 3-Clause License, see LICENSE file for details.
+
+package main
+
+import (
+	"strconv"
+	"sync"
+	"time"
+
+	"cost.li/bapu/gandi"
+)
+
+// datacenterTTL is how long the datacenters are used before they are
+// fetched again. They hardly ever change.
+const datacenterTTL = time.Hour
+
+// datacenterCache holds the datacenters fetched via hosting.datacenter.list
+// for a session.
+type datacenterCache struct {
+	sync.Mutex
+	client  *gandi.Client
+	fetched time.Time
+	list    []gandi.DatacenterReturn
+}
+
+// List returns the datacenters, fetching them if they were not fetched yet
+// or expired. If fetching fails, expired datacenters are returned instead
+// of the error.
+func (c *datacenterCache) List() ([]gandi.DatacenterReturn, error) {
+	c.Lock()
+	defer c.Unlock()
+
+	if c.list != nil && time.Since(c.fetched) < datacenterTTL {
+		return c.list, nil
+	}
+
+	list, err := c.client.DatacenterList()
+	if err != nil {
+		if c.list != nil {
+			return c.list, nil
+		}
+		return nil, err
+	}
+
+	c.list = list
+	c.fetched = time.Now()
+
+	return c.list, nil
+}
+
+// datacenterName returns the name and country code of the datacenter with
+// the given id, or the id if it is not among datacenters.
+func datacenterName(datacenters []gandi.DatacenterReturn, id int) string {
+	for _, dc := range datacenters {
+		if dc.ID == id {
+			return dc.Name + " (" + dc.ISO + ")"
+		}
+	}
+
+	return strconv.Itoa(id)
+}
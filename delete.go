@@ -0,0 +1,138 @@
+// Copyright 2017, Carlo Strub <cs@carlostrub.ch>
+// BSD 3-Clause License, see LICENSE file for details.
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"cost.li/bapu/gandi"
+)
+
+// deleteVM asks for confirmation and deletes the selected virtual machine.
+// A machine which is not halted is stopped first, and its other disks are
+// deleted along if the user wishes so.
+func (a *app) deleteVM() {
+	a.Lock()
+	if len(a.list) == 0 {
+		a.Unlock()
+		return
+	}
+	client := a.client
+	id := a.list[a.selector].ID
+	a.Unlock()
+
+	vm, err := client.VMInfo(id)
+
+	a.Lock()
+	defer a.Unlock()
+
+	if err == nil {
+		switch vm.State {
+		case "halted", "running", "paused":
+		default:
+			err = fmt.Errorf("%s is %s and cannot be deleted", vm.Hostname, vm.State)
+		}
+	}
+	showError(a.uiError, err)
+	if err != nil || client != a.client {
+		a.render()
+		return
+	}
+
+	var others []gandi.DiskReturn
+	var names []string
+	for _, disk := range vm.Disks {
+		if !disk.IsBootDisk {
+			others = append(others, disk)
+			names = append(names, disk.Name)
+		}
+	}
+
+	stopFirst := vm.State != "halted"
+	var disks []gandi.DiskReturn
+
+	var steps []func(next func()) dialog
+	if stopFirst {
+		steps = append(steps, func(next func()) dialog {
+			return newConfirmation("Stop "+vm.Hostname, []string{
+				vm.Hostname + " is " + vm.State + " and must be halted before it can be deleted.",
+				"Stop it now and delete it once it is halted?",
+			}, next)
+		})
+	}
+	steps = append(steps, func(next func()) dialog {
+		validate := func(input string) error {
+			if input != vm.Hostname {
+				return errors.New("does not match the hostname")
+			}
+			return nil
+		}
+		return newPrompt("Delete "+vm.Hostname, "Type the hostname to confirm", "", validate, func(string) {
+			next()
+		})
+	})
+	if len(others) > 0 {
+		steps = append(steps, func(next func()) dialog {
+			return newChooser("Other disks of "+vm.Hostname, []string{
+				"Keep " + strings.Join(names, ", "),
+				"Delete " + strings.Join(names, ", ") + " as well",
+			}, func(i int) {
+				if i == 1 {
+					disks = others
+				}
+				next()
+			})
+		})
+	}
+	steps = append(steps, func(next func()) dialog {
+		lines := []string{"The machine and its boot disk will be deleted for good."}
+		if stopFirst {
+			lines = append(lines, "It will be stopped first.")
+		}
+		if len(disks) > 0 {
+			lines = append(lines, "The disks "+strings.Join(names, ", ")+" will be deleted as well.")
+		} else if len(others) > 0 {
+			lines = append(lines, "The disks "+strings.Join(names, ", ")+" will be detached and kept.")
+		}
+		return newConfirmation("Delete "+vm.Hostname, lines, func() {
+			next()
+			// Called from handleKey with the lock held
+			if stopFirst {
+				go a.stopThenDelete(client, vm, disks)
+			} else {
+				go a.removeVM(client, vm, disks)
+			}
+		})
+	})
+
+	a.dialog = newWizard(steps...)
+	a.render()
+}
+
+// stopThenDelete stops vm and deletes it, along with disks, once it is
+// halted.
+func (a *app) stopThenDelete(client *gandi.Client, vm gandi.VMReturn, disks []gandi.DiskReturn) {
+	op, err := client.VMStop(vm.ID)
+	a.track(client, vm.Hostname, op, err, func(op gandi.OperationReturn) {
+		if op.Step == gandi.StepDone {
+			a.removeVM(client, vm, disks)
+		}
+	})
+}
+
+// removeVM calls hosting.vm.delete on the halted vm and deletes disks once
+// they are detached.
+func (a *app) removeVM(client *gandi.Client, vm gandi.VMReturn, disks []gandi.DiskReturn) {
+	op, err := client.VMDelete(vm.ID)
+	a.track(client, vm.Hostname, op, err, func(op gandi.OperationReturn) {
+		if op.Step == gandi.StepDone {
+			for _, disk := range disks {
+				op, err := client.DiskDelete(disk.ID)
+				a.track(client, disk.Name, op, err, nil)
+			}
+		}
+	})
+}
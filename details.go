@@ -0,0 +1,118 @@
+// Copyright 2017, Carlo Strub <cs@carlostrub.ch>
+// BSD 3-Clause License, see LICENSE file for details.
+
+package main
+
+import (
+	"fmt"
+	"strconv"
+
+	"cost.li/bapu/gandi"
+)
+
+// dateFormat is used wherever bapu shows a date.
+const dateFormat = "2006-01-02 15:04"
+
+// vmDetails describes vm, as returned by hosting.vm.info, line by line. dc
+// is the name of its datacenter.
+func vmDetails(vm gandi.VMReturn, dc string) (lines []string) {
+	console := "disabled"
+	if vm.Console != 0 {
+		console = "enabled " + vm.ConsoleURL
+	}
+
+	lines = append(lines,
+		fmt.Sprintf("Hostname:     %s (ID %d)", vm.Hostname, vm.ID),
+		fmt.Sprintf("Description:  %s", vm.Description),
+		fmt.Sprintf("State:        %s (HVM %s)", vm.State, vm.HVMState),
+		fmt.Sprintf("Datacenter:   %s    Farm: %s", dc, vm.Farm),
+		fmt.Sprintf("Cores:        %d    Flex shares: %d", vm.Cores, vm.FlexShares),
+		fmt.Sprintf("Memory:       %dMB (max %dMB)", vm.Memory, vm.VMmaxMemory),
+		fmt.Sprintf("Console:      %s", console),
+		fmt.Sprintf("Created:      %s    Updated: %s", vm.DateCreated.Format(dateFormat), vm.DateUpdated.Format(dateFormat)),
+		"",
+		"Network interfaces",
+	)
+
+	if len(vm.Ifaces) == 0 {
+		lines = append(lines, "  none")
+	}
+	for _, iface := range vm.Ifaces {
+		lines = append(lines, fmt.Sprintf("  #%d  %s  %s  bandwidth %.0f kbit/s", iface.Num, iface.Type, iface.State, iface.Bandwidth))
+		for _, ip := range iface.IPs {
+			lines = append(lines, fmt.Sprintf("      IPv%d %s  reverse %s", ip.Version, ip.IP, ip.Reverse))
+		}
+	}
+
+	lines = append(lines, "", "Disks")
+	if len(vm.Disks) == 0 {
+		lines = append(lines, "  none")
+	}
+	for _, disk := range vm.Disks {
+		boot := ""
+		if disk.IsBootDisk {
+			boot = "  boot"
+		}
+		lines = append(lines, "  "+disk.Name+"  "+strconv.Itoa(disk.Size)+"MB  "+disk.Type+"  kernel "+disk.KernelVersion+boot)
+	}
+
+	return lines
+}
+
+// ifaceDetails describes iface line by line. ips are its IP addresses, dc
+// is the name of its datacenter and vm the hostname of the virtual machine
+// it is attached to, if any.
+func ifaceDetails(iface gandi.IfaceReturn, ips []gandi.IPReturn, dc, vm string) (lines []string) {
+	vlan := "none"
+	if iface.VLAN.ID != 0 {
+		vlan = fmt.Sprintf("%s (subnet %s, gateway %s)", iface.VLAN.Name, iface.VLAN.Subnet, iface.VLAN.Gateway)
+	}
+	attached := "none"
+	if vm != "" {
+		attached = fmt.Sprintf("%s as #%d", vm, iface.Num)
+	}
+
+	lines = append(lines,
+		fmt.Sprintf("Interface:    %d    Type: %s", iface.ID, iface.Type),
+		fmt.Sprintf("State:        %s", iface.State),
+		fmt.Sprintf("Bandwidth:    %.0f kbit/s", iface.Bandwidth),
+		fmt.Sprintf("VLAN:         %s", vlan),
+		fmt.Sprintf("Datacenter:   %s", dc),
+		fmt.Sprintf("Attached to:  %s", attached),
+		fmt.Sprintf("Created:      %s    Updated: %s", iface.DateCreated.Format(dateFormat), iface.DateUpdated.Format(dateFormat)),
+		"",
+		"IP addresses",
+	)
+
+	if len(ips) == 0 {
+		lines = append(lines, "  none")
+	}
+	for _, ip := range ips {
+		lines = append(lines, fmt.Sprintf("  IPv%d %s  %s  reverse %s", ip.Version, ip.IP, ip.State, ip.Reverse))
+	}
+
+	return lines
+}
+
+// diskDetails describes disk line by line. dc is the name of its
+// datacenter, vms the hostnames of the virtual machines it is attached to
+// and snapshots a summary of its snapshots.
+func diskDetails(disk gandi.DiskReturn, dc, vms, snapshots string) []string {
+	if vms == "" {
+		vms = "none"
+	}
+
+	return []string{
+		fmt.Sprintf("Name:         %s (ID %d)", disk.Name, disk.ID),
+		fmt.Sprintf("State:        %s", disk.State),
+		fmt.Sprintf("Size:         %dMB (total %dMB)", disk.Size, disk.TotalSize),
+		fmt.Sprintf("Type:         %s    Visibility: %s", disk.Type, disk.Visibility),
+		fmt.Sprintf("Datacenter:   %s", dc),
+		fmt.Sprintf("Attached to:  %s", vms),
+		fmt.Sprintf("Boot disk:    %t", disk.IsBootDisk),
+		fmt.Sprintf("Kernel:       %s", disk.KernelVersion),
+		fmt.Sprintf("Image:        %s", disk.Label),
+		fmt.Sprintf("Snapshots:    %s", snapshots),
+		fmt.Sprintf("Created:      %s    Updated: %s", disk.DateCreated.Format(dateFormat), disk.DateUpdated.Format(dateFormat)),
+	}
+}
@@ -0,0 +1,332 @@
+// Copyright 2017, Carlo Strub <cs@carlostrub.ch>
+// BSD 3-Clause License, see LICENSE file for details.
+
+package main
+
+import (
+	"strings"
+
+	"github.com/gizak/termui"
+)
+
+// dialog is a modal window drawn on top of the body. While a dialog is
+// open, it receives all key presses.
+type dialog interface {
+	termui.Bufferer
+
+	// HandleKey processes a key press and reports whether the dialog is
+	// finished and should be closed.
+	HandleKey(key string) (done bool)
+}
+
+// chooser is a dialog to pick one of several items.
+type chooser struct {
+	*termui.List
+	items    []string
+	selected int
+	onChoose func(i int)
+}
+
+// newChooser returns a chooser titled title offering items. onChoose is
+// called with the index of the chosen item unless the user cancels.
+func newChooser(title string, items []string, onChoose func(i int)) *chooser {
+	c := &chooser{
+		List:     termui.NewList(),
+		items:    items,
+		onChoose: onChoose,
+	}
+
+	c.BorderLabel = title + " (<Enter> choose, <Esc> cancel)"
+	c.Height = len(items) + 2
+	c.Width = 60
+	for _, text := range append(items, c.BorderLabel) {
+		if len(text)+4 > c.Width {
+			c.Width = len(text) + 4
+		}
+	}
+	if max := termui.TermWidth() - 4; c.Width > max {
+		c.Width = max
+	}
+	c.Float = termui.AlignCenter
+	c.ItemFgColor = termui.ColorWhite
+	c.update()
+
+	return c
+}
+
+// Select preselects the item with index i.
+func (c *chooser) Select(i int) {
+	if i >= 0 && i < len(c.items) {
+		c.selected = i
+	}
+	c.update()
+}
+
+func (c *chooser) update() {
+	c.Items = make([]string, len(c.items))
+	for i, item := range c.items {
+		if i == c.selected {
+			c.Items[i] = "[> " + item + "](fg-black,bg-white)"
+		} else {
+			c.Items[i] = "  " + item
+		}
+	}
+}
+
+// HandleKey implements dialog.
+func (c *chooser) HandleKey(key string) bool {
+	switch key {
+	case "<up>":
+		if c.selected > 0 {
+			c.selected--
+		}
+	case "<down>":
+		if c.selected < len(c.items)-1 {
+			c.selected++
+		}
+	case "<enter>":
+		if len(c.items) > 0 {
+			c.onChoose(c.selected)
+		}
+		return true
+	case "<escape>":
+		return true
+	}
+	c.update()
+
+	return false
+}
+
+// viewer is a dialog showing lines of text, scrollable with the arrow keys.
+// Further keys may be bound to actions, which close the viewer.
+type viewer struct {
+	*termui.List
+	title   string
+	lines   []string
+	offset  int
+	keys    []string
+	actions map[string]func()
+}
+
+// newViewer returns a viewer titled title showing lines.
+func newViewer(title string, lines []string) *viewer {
+	v := &viewer{
+		List:    termui.NewList(),
+		title:   title,
+		lines:   lines,
+		actions: make(map[string]func()),
+	}
+
+	v.BorderLabel = title + " (<Up>/<Down> scroll, <Esc> close)"
+	v.Height = len(lines) + 2
+	if max := termui.TermHeight() - 4; v.Height > max {
+		v.Height = max
+	}
+	v.Width = termui.TermWidth() - 10
+	v.Float = termui.AlignCenter
+	v.ItemFgColor = termui.ColorWhite
+	v.Items = lines
+
+	return v
+}
+
+// addAction binds key to action, described by label in the title. The
+// viewer is closed before action is called.
+func (v *viewer) addAction(key, label string, action func()) {
+	v.keys = append(v.keys, "<"+key+"> "+label)
+	v.actions[key] = action
+
+	v.BorderLabel = v.title + " (<Up>/<Down> scroll, " + strings.Join(v.keys, ", ") + ", <Esc> close)"
+}
+
+// HandleKey implements dialog.
+func (v *viewer) HandleKey(key string) bool {
+	if action, ok := v.actions[key]; ok {
+		action()
+		return true
+	}
+
+	switch key {
+	case "<up>":
+		if v.offset > 0 {
+			v.offset--
+		}
+	case "<down>":
+		if v.offset < len(v.lines)-(v.Height-2) {
+			v.offset++
+		}
+	case "<escape>", "<enter>", "q":
+		return true
+	}
+	v.Items = v.lines[v.offset:]
+
+	return false
+}
+
+// prompt is a dialog to enter a line of text.
+type prompt struct {
+	*termui.Par
+	label    string
+	input    string
+	errMsg   string
+	validate func(input string) error
+	onEnter  func(input string)
+}
+
+// newPrompt returns a prompt titled title asking for label, prefilled with
+// value. validate, if not nil, is called on enter and keeps the prompt open
+// while it fails. onEnter is called with the input unless the user cancels.
+func newPrompt(title, label, value string, validate func(input string) error, onEnter func(input string)) *prompt {
+	p := &prompt{
+		Par:      termui.NewPar(""),
+		label:    label,
+		input:    value,
+		validate: validate,
+		onEnter:  onEnter,
+	}
+
+	p.BorderLabel = title + " (<Enter> accept, <Esc> cancel)"
+	p.Height = 5
+	p.Width = 70
+	p.Float = termui.AlignCenter
+	p.TextFgColor = termui.ColorWhite
+	p.update()
+
+	return p
+}
+
+func (p *prompt) update() {
+	p.Text = p.label + ": " + p.input + "_"
+	if p.errMsg != "" {
+		p.Text += "\n\n[" + p.errMsg + "](fg-red)"
+	}
+}
+
+// HandleKey implements dialog.
+func (p *prompt) HandleKey(key string) bool {
+	switch key {
+	case "<enter>":
+		if p.validate != nil {
+			if err := p.validate(p.input); err != nil {
+				p.errMsg = err.Error()
+				p.update()
+				return false
+			}
+		}
+		p.onEnter(p.input)
+		return true
+	case "<escape>":
+		return true
+	case "<backspace>", "C-8", "C-\u00df":
+		// Terminals send either ^H or DEL for backspace
+		if len(p.input) > 0 {
+			r := []rune(p.input)
+			p.input = string(r[:len(r)-1])
+		}
+	case "<space>":
+		p.input += " "
+	default:
+		if len([]rune(key)) == 1 {
+			p.input += key
+		}
+	}
+	p.errMsg = ""
+	p.update()
+
+	return false
+}
+
+// wizard is a dialog leading through a sequence of dialogs. Each step
+// returns the dialog to show and receives next, which it must call before
+// its dialog closes to advance; a step closing without calling next cancels
+// the whole wizard. A step returning nil is skipped, except for the first.
+type wizard struct {
+	steps   []func(next func()) dialog
+	current dialog
+	step    int
+	advance bool
+}
+
+// newWizard returns a wizard running steps in order.
+func newWizard(steps ...func(next func()) dialog) *wizard {
+	w := &wizard{steps: steps}
+	w.current = w.steps[0](w.next)
+
+	return w
+}
+
+func (w *wizard) next() {
+	w.advance = true
+}
+
+// Buffer implements termui.Bufferer.
+func (w *wizard) Buffer() termui.Buffer {
+	return w.current.Buffer()
+}
+
+// HandleKey implements dialog.
+func (w *wizard) HandleKey(key string) bool {
+	if !w.current.HandleKey(key) {
+		return false
+	}
+	if !w.advance {
+		return true
+	}
+
+	w.advance = false
+	for w.step++; w.step < len(w.steps); w.step++ {
+		// The screen still shows the previous dialog, which may be larger
+		termui.Clear()
+		if w.current = w.steps[w.step](w.next); w.current != nil {
+			return false
+		}
+	}
+
+	return true
+}
+
+// confirmation is a dialog showing lines of text and asking whether to go
+// ahead.
+type confirmation struct {
+	*termui.List
+	onConfirm func()
+}
+
+// newConfirmation returns a confirmation titled title showing lines.
+// onConfirm is called unless the user cancels.
+func newConfirmation(title string, lines []string, onConfirm func()) *confirmation {
+	c := &confirmation{
+		List:      termui.NewList(),
+		onConfirm: onConfirm,
+	}
+
+	c.BorderLabel = title + " (<Enter> confirm, <Esc> cancel)"
+	c.Height = len(lines) + 2
+	c.Width = 70
+	for _, line := range lines {
+		if len(line)+4 > c.Width {
+			c.Width = len(line) + 4
+		}
+	}
+	if max := termui.TermWidth() - 4; c.Width > max {
+		c.Width = max
+	}
+	c.Float = termui.AlignCenter
+	c.ItemFgColor = termui.ColorWhite
+	c.Items = lines
+
+	return c
+}
+
+// HandleKey implements dialog.
+func (c *confirmation) HandleKey(key string) bool {
+	switch key {
+	case "<enter>":
+		c.onConfirm()
+		return true
+	case "<escape>":
+		return true
+	}
+
+	return false
+}
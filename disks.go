@@ -0,0 +1,361 @@
+// Copyright 2017, Carlo Strub <cs@carlostrub.ch>
+// BSD 3-Clause License, see LICENSE file for details.
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"cost.li/bapu/gandi"
+	"github.com/gizak/termui"
+)
+
+// minDiskSize is the smallest disk Gandi creates, in MB.
+const minDiskSize = 1024
+
+var diskNamePattern = regexp.MustCompile(`^[a-zA-Z0-9_]{1,63}$`)
+
+// validateDiskName accepts disk names made of letters, digits and
+// underscores.
+func validateDiskName(input string) error {
+	if !diskNamePattern.MatchString(input) {
+		return errors.New("use letters, digits and underscores only")
+	}
+	return nil
+}
+
+// vmName returns the hostname of the virtual machine with the given id, or
+// the id if it is not among vms.
+func vmName(vms []gandi.VMReturn, id int) string {
+	for _, vm := range vms {
+		if vm.ID == id {
+			return vm.Hostname
+		}
+	}
+
+	return strconv.Itoa(id)
+}
+
+// diskName returns the name of the disk with the given id, or the id if it
+// is not among disks.
+func diskName(disks []gandi.DiskReturn, id int) string {
+	for _, disk := range disks {
+		if disk.ID == id {
+			return disk.Name
+		}
+	}
+
+	return strconv.Itoa(id)
+}
+
+// attachedTo returns the hostnames of the virtual machines disk is attached
+// to.
+func attachedTo(disk gandi.DiskReturn, vms []gandi.VMReturn) string {
+	var names []string
+	for _, id := range disk.VMsID {
+		names = append(names, vmName(vms, id))
+	}
+
+	return strings.Join(names, ", ")
+}
+
+// diskList returns the rows of the disk table. If grouped is set, list is
+// sorted by datacenter and the datacenter is only named on the first row of
+// its group.
+func diskList(list []gandi.DiskReturn, selector int, vms []gandi.VMReturn, datacenters []gandi.DatacenterReturn, grouped bool) (disks [][]string) {
+	disks = append(disks, []string{
+		"Selected",
+		"Name",
+		"Size",
+		"Type",
+		"State",
+		"Datacenter",
+		"Attached to",
+		"Boot",
+		"Kernel",
+	})
+
+	for i, val := range list {
+		s := ""
+		if selector == i {
+			s = "*"
+		}
+		dc := datacenterName(datacenters, val.DatacenterID)
+		if grouped && i > 0 && list[i-1].DatacenterID == val.DatacenterID {
+			dc = ""
+		}
+		vm := attachedTo(val, vms)
+		if vm == "" {
+			vm = "-"
+		}
+		boot := ""
+		if val.IsBootDisk {
+			boot = "yes"
+		}
+		disks = append(disks, []string{
+			s,
+			val.Name,
+			strconv.Itoa(val.Size) + "MB",
+			val.Type,
+			val.State,
+			dc,
+			vm,
+			boot,
+			val.KernelVersion,
+		})
+	}
+
+	return disks
+}
+
+// colorDiskRows colors the rows of the disk table according to the state of
+// the respective disk. Disks not attached to any virtual machine stand out,
+// unless they are snapshots.
+func colorDiskRows(table *termui.Table, list []gandi.DiskReturn) {
+	colorTable(table, len(list), func(i int) (bg, fg termui.Attribute, ok bool) {
+		switch {
+		case list[i].State == "being_created":
+			return termui.ColorWhite, termui.ColorBlack, true
+		case list[i].State == "deleted":
+			return termui.ColorBlack, termui.ColorRed, true
+		case len(list[i].VMsID) == 0 && list[i].Type != "snapshot":
+			return termui.ColorYellow, termui.ColorBlack, true
+		}
+
+		return 0, 0, false
+	})
+}
+
+// selectedDisk returns the selected disk of the disk tab. The caller must
+// hold the lock.
+func (a *app) selectedDisk() (gandi.DiskReturn, bool) {
+	if len(a.diskList) == 0 {
+		return gandi.DiskReturn{}, false
+	}
+
+	return a.diskList[a.diskSelector], true
+}
+
+// handleDiskKey processes the key presses of the disk tab.
+func (a *app) handleDiskKey(key string) {
+	switch key {
+	case "c":
+		a.createDisk()
+	case "n":
+		a.renameDisk()
+	case "e":
+		a.resizeDisk()
+	case "d":
+		a.deleteDisk()
+	case "t":
+		a.Lock()
+		if disk, ok := a.selectedDisk(); ok {
+			a.chooseVMFor(disk)
+		}
+		a.render()
+		a.Unlock()
+	case "x":
+		a.detachDisk()
+	case "p":
+		a.snapshotMenu()
+	case "k":
+		a.Lock()
+		disk, ok := a.selectedDisk()
+		a.Unlock()
+		if ok {
+			a.chooseKernel(disk)
+		}
+	case "<enter>":
+		a.showDisk()
+	}
+}
+
+// showDisk opens a dialog with everything known about the selected disk.
+func (a *app) showDisk() {
+	a.Lock()
+	defer a.Unlock()
+
+	disk, ok := a.selectedDisk()
+	if !ok {
+		return
+	}
+
+	snapshots := fmt.Sprintf("%d taken", len(snapshotsOf(disk, a.disks)))
+	switch {
+	case disk.Type == "snapshot":
+		snapshots = "snapshot of " + diskName(a.disks, disk.Source)
+	case !disk.CanSnapshot:
+		snapshots = "not possible"
+	case disk.SnapshotProfile.ID != 0:
+		snapshots += ", profile " + disk.SnapshotProfile.Name + " (" + profileSummary(disk.SnapshotProfile) + ")"
+	default:
+		snapshots += ", no profile"
+	}
+
+	a.dialog = newViewer(disk.Name, diskDetails(disk, datacenterName(a.dcs, disk.DatacenterID), attachedTo(disk, a.vms), snapshots))
+	a.render()
+}
+
+// createDisk asks for the datacenter, name and size of a new empty disk and
+// creates it via hosting.disk.create.
+func (a *app) createDisk() {
+	a.Lock()
+	client := a.client
+	cache := a.datacenters
+	a.Unlock()
+
+	datacenters, err := cache.List()
+
+	a.Lock()
+	defer a.Unlock()
+
+	showError(a.uiError, err)
+	if err != nil || client != a.client {
+		a.render()
+		return
+	}
+
+	var spec gandi.DiskCreateSpec
+	var dcName string
+
+	a.dialog = newWizard(
+		func(next func()) dialog {
+			var names []string
+			for _, dc := range datacenters {
+				names = append(names, datacenterName(datacenters, dc.ID))
+			}
+			return newChooser("Datacenter", names, func(i int) {
+				spec.DatacenterID = datacenters[i].ID
+				dcName = names[i]
+				next()
+			})
+		},
+		func(next func()) dialog {
+			return newPrompt("New disk", "Name", "", validateDiskName, func(input string) {
+				spec.Name = input
+				next()
+			})
+		},
+		func(next func()) dialog {
+			return newPrompt("New disk", "Size in MB", strconv.Itoa(defaultDiskSize), intValidator(minDiskSize), func(input string) {
+				spec.Size, _ = strconv.Atoi(strings.TrimSpace(input))
+				next()
+			})
+		},
+		func(next func()) dialog {
+			return newConfirmation("Create "+spec.Name, []string{
+				"Name:        " + spec.Name,
+				"Datacenter:  " + dcName,
+				fmt.Sprintf("Size:        %dMB", spec.Size),
+			}, func() {
+				next()
+				// Called from handleKey with the lock held
+				go func() {
+					op, err := client.DiskCreate(spec)
+					a.track(client, spec.Name, op, err, nil)
+				}()
+			})
+		},
+	)
+	a.render()
+}
+
+// renameDisk asks for a new name of the selected disk.
+func (a *app) renameDisk() {
+	a.Lock()
+	defer a.Unlock()
+
+	disk, ok := a.selectedDisk()
+	if !ok {
+		return
+	}
+	client := a.client
+
+	a.dialog = newPrompt("Rename "+disk.Name, "New name", disk.Name, validateDiskName, func(input string) {
+		if input == disk.Name {
+			return
+		}
+		go func() {
+			op, err := client.DiskUpdate(disk.ID, gandi.DiskUpdateSpec{Name: input})
+			a.track(client, disk.Name, op, err, nil)
+		}()
+	})
+	a.render()
+}
+
+// resizeDisk asks for the new size of the selected disk. Disks can only
+// grow.
+func (a *app) resizeDisk() {
+	a.Lock()
+	defer a.Unlock()
+
+	disk, ok := a.selectedDisk()
+	if !ok {
+		return
+	}
+	client := a.client
+	var size int
+
+	a.dialog = newWizard(
+		func(next func()) dialog {
+			label := fmt.Sprintf("Size in MB (at least %dMB)", disk.Size)
+			return newPrompt("Resize "+disk.Name, label, strconv.Itoa(disk.Size), intValidator(disk.Size), func(input string) {
+				size, _ = strconv.Atoi(strings.TrimSpace(input))
+				if size > disk.Size {
+					next()
+				}
+			})
+		},
+		func(next func()) dialog {
+			lines := []string{fmt.Sprintf("%s grows from %dMB to %dMB.", disk.Name, disk.Size, size)}
+			if len(disk.VMsID) > 0 {
+				lines = append(lines, "The file system has to be grown within "+attachedTo(disk, a.vms)+" afterwards.")
+			}
+			return newConfirmation("Resize "+disk.Name, lines, func() {
+				next()
+				// Called from handleKey with the lock held
+				go func() {
+					op, err := client.DiskUpdate(disk.ID, gandi.DiskUpdateSpec{Size: size})
+					a.track(client, disk.Name, op, err, nil)
+				}()
+			})
+		},
+	)
+	a.render()
+}
+
+// deleteDisk deletes the selected disk after the user typed its name.
+// Disks attached to a virtual machine have to be detached first.
+func (a *app) deleteDisk() {
+	a.Lock()
+	defer a.Unlock()
+
+	disk, ok := a.selectedDisk()
+	if !ok {
+		return
+	}
+	if len(disk.VMsID) > 0 {
+		showError(a.uiError, fmt.Errorf("%s is attached to %s, detach it first", disk.Name, attachedTo(disk, a.vms)))
+		a.render()
+		return
+	}
+	client := a.client
+
+	validate := func(input string) error {
+		if input != disk.Name {
+			return errors.New("does not match the name of the disk")
+		}
+		return nil
+	}
+	a.dialog = newPrompt("Delete "+disk.Name, "Type the name of the disk to confirm", "", validate, func(string) {
+		go func() {
+			op, err := client.DiskDelete(disk.ID)
+			a.track(client, disk.Name, op, err, nil)
+		}()
+	})
+	a.render()
+}
@@ -0,0 +1,77 @@
+// Copyright 2017, Carlo Strub <cs@carlostrub.ch>
+// BSD 3-Clause License, see LICENSE file for details.
+
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"regexp"
+	"strings"
+
+	"github.com/spf13/viper"
+)
+
+var reversePattern = regexp.MustCompile(`^([a-zA-Z0-9]([a-zA-Z0-9-]{0,61}[a-zA-Z0-9])?\.)+[a-zA-Z]{2,63}\.?$`)
+
+// validateReverse accepts fully qualified hostnames.
+func validateReverse(input string) error {
+	if !reversePattern.MatchString(strings.TrimSpace(input)) {
+		return errors.New("not a fully qualified hostname such as mail.example.net")
+	}
+	return nil
+}
+
+// checkForward verifies that name resolves to ip, so that the reverse DNS
+// of ip can point to name. The resolver configured as dns.resolver is
+// asked, or else the one of the system.
+func checkForward(name, ip string) error {
+	name = strings.TrimSuffix(strings.TrimSpace(name), ".")
+
+	viper.SetDefault("dns.timeout", "5s")
+	ctx, cancel := context.WithTimeout(context.Background(), viper.GetDuration("dns.timeout"))
+	defer cancel()
+
+	addrs, err := resolver().LookupHost(ctx, name)
+	if isNotFound(err) {
+		addrs, err = nil, nil
+	}
+	if err != nil {
+		return fmt.Errorf("cannot resolve %s: %v", name, err)
+	}
+
+	want := net.ParseIP(ip)
+	for _, addr := range addrs {
+		if want.Equal(net.ParseIP(addr)) {
+			return nil
+		}
+	}
+	if len(addrs) == 0 {
+		return fmt.Errorf("%s does not resolve, add a record pointing to %s first", name, ip)
+	}
+
+	return fmt.Errorf("%s resolves to %s, not to %s", name, strings.Join(addrs, ", "), ip)
+}
+
+// resolver returns a resolver asking the DNS server configured as
+// dns.resolver, given as host or host:port, or the default resolver if
+// there is none.
+func resolver() *net.Resolver {
+	server := viper.GetString("dns.resolver")
+	if server == "" {
+		return net.DefaultResolver
+	}
+	if _, _, err := net.SplitHostPort(server); err != nil {
+		server = net.JoinHostPort(server, "53")
+	}
+
+	return &net.Resolver{
+		PreferGo: true,
+		Dial: func(ctx context.Context, network, address string) (net.Conn, error) {
+			var d net.Dialer
+			return d.DialContext(ctx, network, server)
+		},
+	}
+}
@@ -0,0 +1,17 @@
+// Copyright 2017, Carlo Strub <cs@carlostrub.ch>
+// BSD 3-Clause License, see LICENSE file for details.
+
+//go:build !go1.13
+// +build !go1.13
+
+package main
+
+import "net"
+
+// isNotFound reports whether err tells that a name does not exist. Before
+// Go 1.13, net.DNSError only tells so by the message of the resolvers of
+// the net package.
+func isNotFound(err error) bool {
+	dnsErr, ok := err.(*net.DNSError)
+	return ok && dnsErr.Err == "no such host"
+}
@@ -0,0 +1,116 @@
+// Copyright 2017, Carlo Strub <cs@carlostrub.ch>
+// BSD 3-Clause License, see LICENSE file for details.
+
+package main
+
+import (
+	"encoding/binary"
+	"net"
+	"strings"
+	"testing"
+
+	"github.com/spf13/viper"
+)
+
+// DNS response codes answered by serveDNS
+const (
+	rcodeOK       = 0
+	rcodeServFail = 2
+	rcodeNXDomain = 3
+)
+
+// serveDNS answers the A queries received on conn from records, a map of
+// names without the trailing dot to IPv4 addresses. Names ending in
+// ".broken" fail and unknown names do not exist. Other queries are
+// answered without records.
+func serveDNS(conn net.PacketConn, records map[string][]string) {
+	buf := make([]byte, 512)
+	for {
+		n, addr, err := conn.ReadFrom(buf)
+		if err != nil {
+			return
+		}
+		query := buf[:n]
+		if len(query) < 12 {
+			continue
+		}
+
+		// The question follows the header as labels, type and class
+		end := 12
+		var labels []string
+		for end < len(query) && query[end] != 0 {
+			size := int(query[end])
+			if end+1+size > len(query) {
+				break
+			}
+			labels = append(labels, string(query[end+1:end+1+size]))
+			end += 1 + size
+		}
+		end += 5
+		if end > len(query) {
+			continue
+		}
+		name := strings.ToLower(strings.Join(labels, "."))
+		qtype := binary.BigEndian.Uint16(query[end-4 : end-2])
+
+		rcode := rcodeOK
+		var answers []string
+		switch {
+		case strings.HasSuffix(name, ".broken"):
+			rcode = rcodeServFail
+		case records[name] == nil:
+			rcode = rcodeNXDomain
+		case qtype == 1:
+			answers = records[name]
+		}
+
+		reply := make([]byte, 12, 512)
+		copy(reply, query[:2])
+		binary.BigEndian.PutUint16(reply[2:], 0x8180|uint16(rcode))
+		binary.BigEndian.PutUint16(reply[4:], 1)
+		binary.BigEndian.PutUint16(reply[6:], uint16(len(answers)))
+		reply = append(reply, query[12:end]...)
+		for _, answer := range answers {
+			// Name pointing to the question, type A, class IN, TTL 60
+			reply = append(reply, 0xc0, 12, 0, 1, 0, 1, 0, 0, 0, 60, 0, 4)
+			reply = append(reply, net.ParseIP(answer).To4()...)
+		}
+		conn.WriteTo(reply, addr)
+	}
+}
+
+func TestCheckForward(t *testing.T) {
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	go serveDNS(conn, map[string][]string{
+		"mail.example.net": {"192.0.2.10"},
+		"www.example.net":  {"192.0.2.20", "192.0.2.21"},
+	})
+
+	viper.Set("dns.resolver", conn.LocalAddr().String())
+	defer viper.Set("dns.resolver", "")
+
+	for _, c := range []struct {
+		name string
+		ip   string
+		err  string // part of the error, empty if the name resolves to ip
+	}{
+		{"mail.example.net", "192.0.2.10", ""},
+		{"mail.example.net.", "192.0.2.10", ""},
+		{"www.example.net", "192.0.2.21", ""},
+		{"mail.example.net", "192.0.2.99", "resolves to 192.0.2.10, not to 192.0.2.99"},
+		{"new.example.net", "192.0.2.10", "does not resolve"},
+		{"mail.example.broken", "192.0.2.10", "cannot resolve"},
+	} {
+		err := checkForward(c.name, c.ip)
+		switch {
+		case c.err == "" && err != nil:
+			t.Errorf("checkForward(%q, %q) = %v, want no error", c.name, c.ip, err)
+		case c.err != "" && (err == nil || !strings.Contains(err.Error(), c.err)):
+			t.Errorf("checkForward(%q, %q) = %v, want error with %q", c.name, c.ip, err, c.err)
+		}
+	}
+}
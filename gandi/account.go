@@ -0,0 +1,27 @@
+// Copyright 2017, Carlo Strub <cs@carlostrub.ch>
+// BSD 3-Clause License, see LICENSE file for details.
+
+package gandi
+
+import (
+	"time"
+)
+
+// AccountReturn contains fields for informations about the Gandi account
+type AccountReturn struct {
+	AverageCreditCost     float64   `xmlrpc:"average_credit_cost"`
+	Credits               int       `xmlrpc:"credits"`
+	CycleDay              int       `xmlrpc:"cycle_day"`
+	DateCreditsExpiration time.Time `xmlrpc:"date_credits_expiration"`
+	FullName              string    `xmlrpc:"fullname"`
+	Handle                string    `xmlrpc:"handle"`
+	ID                    int       `xmlrpc:"id"`
+}
+
+// AccountInfo returns the information about the Gandi account the API key
+// belongs to.
+func (c *Client) AccountInfo() (info AccountReturn, err error) {
+	err = c.call("hosting.account.info", &info)
+
+	return info, err
+}
@@ -0,0 +1,50 @@
+// Copyright 2017, Carlo Strub <cs@carlostrub.ch>
+// BSD 3-Clause License, see LICENSE file for details.
+
+// Package gandi provides a typed client for the Gandi hosting XML-RPC API.
+package gandi
+
+import (
+	"github.com/kolo/xmlrpc"
+)
+
+const (
+	// ProductionURL is the endpoint of the Gandi production API.
+	ProductionURL = "https://rpc.gandi.net/xmlrpc/"
+
+	// DevelopmentURL is the endpoint of the Gandi OT&E (testing) API.
+	DevelopmentURL = "https://rpc.ote.gandi.net/xmlrpc/"
+)
+
+// Client talks to the Gandi XML-RPC API on behalf of a single API key.
+type Client struct {
+	api    *xmlrpc.Client
+	apiKey string
+}
+
+// NewClient returns a Client for the API at url, authenticating every call
+// with apiKey.
+func NewClient(url, apiKey string) (*Client, error) {
+	api, err := xmlrpc.NewClient(url, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Client{
+		api:    api,
+		apiKey: apiKey,
+	}, nil
+}
+
+// call invokes method with the API key prepended to args and decodes the
+// result into reply. Faults returned by the API are reported as *Fault.
+func (c *Client) call(method string, reply interface{}, args ...interface{}) error {
+	params := append([]interface{}{c.apiKey}, args...)
+
+	err := c.api.Call(method, params, reply)
+	if err != nil {
+		return toFault(err)
+	}
+
+	return nil
+}
@@ -0,0 +1,20 @@
+// Copyright 2017, Carlo Strub <cs@carlostrub.ch>
+// BSD 3-Clause License, see LICENSE file for details.
+
+package gandi
+
+// DatacenterReturn contains fields for informations about the datacenters
+type DatacenterReturn struct {
+	Country string `xmlrpc:"country"`
+	DCCode  string `xmlrpc:"dc_code"`
+	ID      int    `xmlrpc:"id"`
+	ISO     string `xmlrpc:"iso"`
+	Name    string `xmlrpc:"name"`
+}
+
+// DatacenterList returns all datacenters.
+func (c *Client) DatacenterList() (datacenters []DatacenterReturn, err error) {
+	err = c.call("hosting.datacenter.list", &datacenters)
+
+	return datacenters, err
+}
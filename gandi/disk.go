@@ -0,0 +1,138 @@
+// Copyright 2017, Carlo Strub <cs@carlostrub.ch>
+// BSD 3-Clause License, see LICENSE file for details.
+
+package gandi
+
+import (
+	"time"
+)
+
+// DiskReturn contains fields for informations about the Disks
+type DiskReturn struct {
+	CanSnapshot     bool                  `xmlrpc:"can_snapshot"`
+	DatacenterID    int                   `xmlrpc:"datacenter_id"`
+	DateCreated     time.Time             `xmlrpc:"date_created"`
+	DateUpdated     time.Time             `xmlrpc:"date_updated"`
+	ID              int                   `xmlrpc:"id"`
+	IsBootDisk      bool                  `xmlrpc:"is_boot_disk"`
+	KernelVersion   string                `xmlrpc:"kernel_version"`
+	Label           string                `xmlrpc:"label"`
+	Name            string                `xmlrpc:"name"`
+	Size            int                   `xmlrpc:"size"`
+	SnapshotProfile SnapshotProfileReturn `xmlrpc:"snapshot_profile"`
+	SnapshotsID     []int                 `xmlrpc:"snapshots_id"`
+	Source          int                   `xmlrpc:"source"` // disk a snapshot was taken of
+	State           string                `xmlrpc:"state"`
+	TotalSize       int                   `xmlrpc:"total_size"`
+	Type            string                `xmlrpc:"type"`
+	Visibility      string                `xmlrpc:"visibility"`
+	VMsID           []int                 `xmlrpc:"vms_id"`
+}
+
+// DiskList returns all disks of the account.
+func (c *Client) DiskList() (disks []DiskReturn, err error) {
+	err = c.call("hosting.disk.list", &disks)
+
+	return disks, err
+}
+
+// DiskInfo returns the disk with the given id.
+func (c *Client) DiskInfo(id int) (disk DiskReturn, err error) {
+	err = c.call("hosting.disk.info", &disk, id)
+
+	return disk, err
+}
+
+// DiskCreateSpec describes a disk to create with DiskCreate or
+// DiskCreateFrom.
+type DiskCreateSpec struct {
+	DatacenterID int
+	Name         string
+	Size         int    // MB
+	Type         string // "data" or "snapshot", only used by DiskCreateFrom
+}
+
+// DiskCreate creates an empty disk according to spec.
+func (c *Client) DiskCreate(spec DiskCreateSpec) (op OperationReturn, err error) {
+	err = c.call("hosting.disk.create", &op, map[string]interface{}{
+		"datacenter_id": spec.DatacenterID,
+		"name":          spec.Name,
+		"size":          spec.Size,
+	})
+
+	return op, err
+}
+
+// DiskCreateFrom creates a disk according to spec as a copy of the disk
+// with id srcDiskID. With Type "snapshot", the copy is a snapshot of the
+// source disk. A Size of 0 keeps the size of the source disk.
+func (c *Client) DiskCreateFrom(spec DiskCreateSpec, srcDiskID int) (op OperationReturn, err error) {
+	params := map[string]interface{}{
+		"datacenter_id": spec.DatacenterID,
+		"name":          spec.Name,
+	}
+	if spec.Size != 0 {
+		params["size"] = spec.Size
+	}
+	if spec.Type != "" {
+		params["type"] = spec.Type
+	}
+
+	err = c.call("hosting.disk.create_from", &op, params, srcDiskID)
+
+	return op, err
+}
+
+// DiskRollbackFrom restores the disk a snapshot was taken of to the state
+// of the snapshot with the given id.
+func (c *Client) DiskRollbackFrom(snapshotID int) (op OperationReturn, err error) {
+	err = c.call("hosting.disk.rollback_from", &op, snapshotID)
+
+	return op, err
+}
+
+// DiskListKernels returns the kernels available in the datacenter with the
+// given id, by family such as "linux-hvm" or "raw".
+func (c *Client) DiskListKernels(dcID int) (kernels map[string][]string, err error) {
+	err = c.call("hosting.disk.list_kernels", &kernels, dcID)
+
+	return kernels, err
+}
+
+// DiskUpdateSpec holds the attributes of a disk to change with DiskUpdate.
+// Attributes left at their zero value are not changed.
+type DiskUpdateSpec struct {
+	Kernel          string // one of DiskListKernels, takes effect on reboot
+	Name            string
+	Size            int // MB, disks can only grow
+	SnapshotProfile int // id of the snapshot profile to apply
+}
+
+// DiskUpdate changes the disk with the given id according to spec.
+func (c *Client) DiskUpdate(id int, spec DiskUpdateSpec) (op OperationReturn, err error) {
+	params := map[string]interface{}{}
+	if spec.Name != "" {
+		params["name"] = spec.Name
+	}
+	if spec.Size != 0 {
+		params["size"] = spec.Size
+	}
+	if spec.SnapshotProfile != 0 {
+		params["snapshot_profile"] = spec.SnapshotProfile
+	}
+	if spec.Kernel != "" {
+		params["kernel"] = spec.Kernel
+	}
+
+	err = c.call("hosting.disk.update", &op, id, params)
+
+	return op, err
+}
+
+// DiskDelete deletes the disk with the given id, which must not be attached
+// to a virtual machine.
+func (c *Client) DiskDelete(id int) (op OperationReturn, err error) {
+	err = c.call("hosting.disk.delete", &op, id)
+
+	return op, err
+}
@@ -0,0 +1,493 @@
+// Copyright 2017, Carlo Strub <cs@carlostrub.ch>
+// BSD 3-Clause License, see LICENSE file for details.
+
+package fake
+
+import (
+	"cost.li/bapu/gandi"
+)
+
+// disksByID returns the disks that are not deleted, ordered by id. The
+// caller must hold s.mu.
+func (s *Server) disksByID() []gandi.DiskReturn {
+	disks := []gandi.DiskReturn{}
+	for _, id := range sortedIDs(s.disks) {
+		if s.disks[id].State != "deleted" {
+			disks = append(disks, s.diskWithVMs(id))
+		}
+	}
+
+	return disks
+}
+
+// disksOf returns the disks attached to the virtual machine with the given
+// id. The caller must hold s.mu.
+func (s *Server) disksOf(vmID int) []gandi.DiskReturn {
+	disks := []gandi.DiskReturn{}
+	for _, id := range s.attached[vmID] {
+		disks = append(disks, s.diskWithVMs(id))
+	}
+
+	return disks
+}
+
+// diskWithVMs returns the disk with the given id including the ids of the
+// virtual machines it is attached to and of its snapshots. The caller must
+// hold s.mu.
+func (s *Server) diskWithVMs(id int) gandi.DiskReturn {
+	disk := *s.disks[id]
+
+	disk.VMsID = []int{}
+	if vmID := s.diskVM(id); vmID != 0 {
+		disk.VMsID = append(disk.VMsID, vmID)
+	}
+
+	disk.SnapshotsID = []int{}
+	for _, snapshotID := range sortedIDs(s.disks) {
+		snapshot := s.disks[snapshotID]
+		if snapshot.Source == id && snapshot.Type == "snapshot" && snapshot.State != "deleted" {
+			disk.SnapshotsID = append(disk.SnapshotsID, snapshotID)
+		}
+	}
+
+	return disk
+}
+
+// lookupProfile returns the snapshot profile with the given id. The caller
+// must hold s.mu.
+func (s *Server) lookupProfile(id int) (gandi.SnapshotProfileReturn, *Fault) {
+	for _, profile := range s.profiles {
+		if profile.ID == id {
+			return profile, nil
+		}
+	}
+
+	return gandi.SnapshotProfileReturn{}, faultf(FaultNotFound, "snapshot profile %d not found", id)
+}
+
+// diskNamed returns the disk which is not deleted with the given name, or
+// nil. The caller must hold s.mu.
+func (s *Server) diskNamed(name string) *gandi.DiskReturn {
+	for _, disk := range s.disks {
+		if disk.Name == name && disk.State != "deleted" {
+			return disk
+		}
+	}
+
+	return nil
+}
+
+// diskVM returns the id of the virtual machine the disk with the given id
+// is attached to, or 0. The caller must hold s.mu.
+func (s *Server) diskVM(diskID int) int {
+	for vmID, ids := range s.attached {
+		for _, id := range ids {
+			if id == diskID {
+				return vmID
+			}
+		}
+	}
+
+	return 0
+}
+
+func diskList(s *Server, params []interface{}) (interface{}, *Fault) {
+	return s.disksByID(), nil
+}
+
+func diskListKernels(s *Server, params []interface{}) (interface{}, *Fault) {
+	dcID, f := intParam(params, 0)
+	if f != nil {
+		return nil, f
+	}
+	if _, f = s.lookupDatacenter(dcID); f != nil {
+		return nil, f
+	}
+
+	return s.kernels[dcID], nil
+}
+
+// hasKernel reports whether kernel is available in the datacenter with the
+// given id. The caller must hold s.mu.
+func (s *Server) hasKernel(dcID int, kernel string) bool {
+	for _, kernels := range s.kernels[dcID] {
+		for _, k := range kernels {
+			if k == kernel {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+func diskInfo(s *Server, params []interface{}) (interface{}, *Fault) {
+	id, f := intParam(params, 0)
+	if f != nil {
+		return nil, f
+	}
+	disk, f := s.lookupDisk(id)
+	if f != nil {
+		return nil, f
+	}
+
+	return s.diskWithVMs(disk.ID), nil
+}
+
+func diskCreate(s *Server, params []interface{}) (interface{}, *Fault) {
+	spec, f := mapParam(params, 0)
+	if f != nil {
+		return nil, f
+	}
+
+	dcID, _, f := intField(spec, "datacenter_id")
+	if f != nil {
+		return nil, f
+	}
+	dc, f := s.lookupDatacenter(dcID)
+	if f != nil {
+		return nil, f
+	}
+	name, _, f := stringField(spec, "name")
+	if f != nil {
+		return nil, f
+	}
+	if name == "" {
+		return nil, faultf(FaultInvalidParams, "name is required")
+	}
+	if s.diskNamed(name) != nil {
+		return nil, faultf(FaultConflict, "disk name %s is already in use", name)
+	}
+	size, _, f := intField(spec, "size")
+	if f != nil {
+		return nil, f
+	}
+	if size < 1024 {
+		return nil, faultf(FaultInvalidParams, "disks must have at least 1024MB")
+	}
+
+	disk := s.disks[s.addDisk(0, gandi.DiskReturn{
+		DatacenterID: dc.ID,
+		Name:         name,
+		Size:         size,
+		State:        "being_created",
+	}).ID]
+
+	return s.newOperation(gandi.OperationReturn{Type: "disk_create", DiskID: disk.ID}, func() {
+		disk.State = "created"
+		disk.DateUpdated = s.now()
+	}), nil
+}
+
+func diskCreateFrom(s *Server, params []interface{}) (interface{}, *Fault) {
+	spec, f := mapParam(params, 0)
+	if f != nil {
+		return nil, f
+	}
+	srcID, f := intParam(params, 1)
+	if f != nil {
+		return nil, f
+	}
+	src, f := s.lookupDisk(srcID)
+	if f != nil {
+		return nil, f
+	}
+
+	dcID, _, f := intField(spec, "datacenter_id")
+	if f != nil {
+		return nil, f
+	}
+	if _, f = s.lookupDatacenter(dcID); f != nil {
+		return nil, f
+	}
+	name, _, f := stringField(spec, "name")
+	if f != nil {
+		return nil, f
+	}
+	if name == "" {
+		return nil, faultf(FaultInvalidParams, "name is required")
+	}
+	if s.diskNamed(name) != nil {
+		return nil, faultf(FaultConflict, "disk name %s is already in use", name)
+	}
+	size, hasSize, f := intField(spec, "size")
+	if f != nil {
+		return nil, f
+	}
+	if !hasSize {
+		size = src.Size
+	}
+	if size < src.Size {
+		return nil, faultf(FaultInvalidParams, "disk %s cannot be copied to less than %dMB", src.Name, src.Size)
+	}
+	typ, hasType, f := stringField(spec, "type")
+	if f != nil {
+		return nil, f
+	}
+	if !hasType {
+		typ = "data"
+	}
+
+	disk := gandi.DiskReturn{
+		DatacenterID:  dcID,
+		KernelVersion: src.KernelVersion,
+		Label:         src.Label,
+		Name:          name,
+		Size:          size,
+		State:         "being_created",
+		Type:          typ,
+	}
+
+	switch typ {
+	case "data":
+	case "snapshot":
+		if !src.CanSnapshot {
+			return nil, faultf(FaultConflict, "disk %s cannot be snapshotted", src.Name)
+		}
+		if dcID != src.DatacenterID {
+			return nil, faultf(FaultInvalidParams, "snapshots must be in the datacenter of their disk")
+		}
+		disk.Size = src.Size
+		disk.Source = src.ID
+	default:
+		return nil, faultf(FaultInvalidParams, "unknown disk type %s", typ)
+	}
+	if src.State != "created" {
+		return nil, faultf(FaultConflict, "disk %s is %s", src.Name, src.State)
+	}
+
+	created := s.disks[s.addDisk(0, disk).ID]
+
+	return s.newOperation(gandi.OperationReturn{Type: "disk_create", DiskID: created.ID}, func() {
+		created.State = "created"
+		created.DateUpdated = s.now()
+	}), nil
+}
+
+func diskRollbackFrom(s *Server, params []interface{}) (interface{}, *Fault) {
+	id, f := intParam(params, 0)
+	if f != nil {
+		return nil, f
+	}
+	snapshot, f := s.lookupDisk(id)
+	if f != nil {
+		return nil, f
+	}
+	if snapshot.Type != "snapshot" {
+		return nil, faultf(FaultInvalidParams, "disk %s is not a snapshot", snapshot.Name)
+	}
+	disk, f := s.lookupDisk(snapshot.Source)
+	if f != nil {
+		return nil, f
+	}
+	if vmID := s.diskVM(disk.ID); vmID != 0 && s.vms[vmID].State != "halted" {
+		vm := s.vms[vmID]
+		return nil, faultf(FaultConflict, "vm %s is %s, stop it to roll back disk %s", vm.Hostname, vm.State, disk.Name)
+	}
+	if disk.State != "created" {
+		return nil, faultf(FaultConflict, "disk %s is %s", disk.Name, disk.State)
+	}
+
+	disk.State = "being_rolled_back"
+
+	return s.newOperation(gandi.OperationReturn{Type: "disk_rollback", DiskID: disk.ID}, func() {
+		disk.State = "created"
+		disk.KernelVersion = snapshot.KernelVersion
+		disk.Label = snapshot.Label
+		disk.DateUpdated = s.now()
+	}), nil
+}
+
+func diskUpdate(s *Server, params []interface{}) (interface{}, *Fault) {
+	id, f := intParam(params, 0)
+	if f != nil {
+		return nil, f
+	}
+	disk, f := s.lookupDisk(id)
+	if f != nil {
+		return nil, f
+	}
+	update, f := mapParam(params, 1)
+	if f != nil {
+		return nil, f
+	}
+
+	name, hasName, f := stringField(update, "name")
+	if f != nil {
+		return nil, f
+	}
+	if !hasName {
+		name = disk.Name
+	}
+	if name == "" {
+		return nil, faultf(FaultInvalidParams, "name must not be empty")
+	}
+	if other := s.diskNamed(name); other != nil && other.ID != disk.ID {
+		return nil, faultf(FaultConflict, "disk name %s is already in use", name)
+	}
+	size, hasSize, f := intField(update, "size")
+	if f != nil {
+		return nil, f
+	}
+	if !hasSize {
+		size = disk.Size
+	}
+	if size < disk.Size {
+		return nil, faultf(FaultInvalidParams, "disk %s cannot shrink below %dMB", disk.Name, disk.Size)
+	}
+	profile := disk.SnapshotProfile
+	profileID, hasProfile, f := intField(update, "snapshot_profile")
+	if f != nil {
+		return nil, f
+	}
+	if hasProfile {
+		if !disk.CanSnapshot {
+			return nil, faultf(FaultConflict, "disk %s cannot be snapshotted", disk.Name)
+		}
+		profile, f = s.lookupProfile(profileID)
+		if f != nil {
+			return nil, f
+		}
+	}
+
+	kernel, hasKernel, f := stringField(update, "kernel")
+	if f != nil {
+		return nil, f
+	}
+	if !hasKernel {
+		kernel = disk.KernelVersion
+	} else if !s.hasKernel(disk.DatacenterID, kernel) {
+		return nil, faultf(FaultInvalidParams, "kernel %s is not available in datacenter %d", kernel, disk.DatacenterID)
+	}
+
+	return s.newOperation(gandi.OperationReturn{Type: "disk_update", DiskID: disk.ID}, func() {
+		disk.KernelVersion = kernel
+		disk.Name = name
+		disk.Size = size
+		disk.TotalSize = size
+		disk.SnapshotProfile = profile
+		disk.DateUpdated = s.now()
+	}), nil
+}
+
+func diskDelete(s *Server, params []interface{}) (interface{}, *Fault) {
+	id, f := intParam(params, 0)
+	if f != nil {
+		return nil, f
+	}
+	disk, f := s.lookupDisk(id)
+	if f != nil {
+		return nil, f
+	}
+	if vmID := s.diskVM(disk.ID); vmID != 0 {
+		return nil, faultf(FaultConflict, "disk %s is attached to vm %s", disk.Name, s.vms[vmID].Hostname)
+	}
+
+	return s.newOperation(gandi.OperationReturn{Type: "disk_delete", DiskID: disk.ID}, func() {
+		disk.State = "deleted"
+		disk.DateUpdated = s.now()
+	}), nil
+}
+
+// flagBootDisk marks the first disk attached to the virtual machine with
+// the given id as its boot disk. The caller must hold s.mu.
+func (s *Server) flagBootDisk(vmID int) {
+	for i, id := range s.attached[vmID] {
+		s.disks[id].IsBootDisk = i == 0
+	}
+}
+
+func vmDiskAttach(s *Server, params []interface{}) (interface{}, *Fault) {
+	vmID, f := intParam(params, 0)
+	if f != nil {
+		return nil, f
+	}
+	vm, f := s.lookupVM(vmID)
+	if f != nil {
+		return nil, f
+	}
+	diskID, f := intParam(params, 1)
+	if f != nil {
+		return nil, f
+	}
+	disk, f := s.lookupDisk(diskID)
+	if f != nil {
+		return nil, f
+	}
+	opts, f := mapParam(params, 2)
+	if f != nil {
+		return nil, f
+	}
+	position, hasPosition, f := intField(opts, "position")
+	if f != nil {
+		return nil, f
+	}
+	if !hasPosition {
+		position = len(s.attached[vm.ID])
+	}
+
+	switch {
+	case s.diskVM(disk.ID) != 0:
+		return nil, faultf(FaultConflict, "disk %s is attached to vm %s", disk.Name, s.vms[s.diskVM(disk.ID)].Hostname)
+	case disk.Type == "snapshot":
+		return nil, faultf(FaultConflict, "disk %s is a snapshot and cannot be attached", disk.Name)
+	case disk.DatacenterID != vm.DatacenterID:
+		return nil, faultf(FaultConflict, "disk %s and vm %s are in different datacenters", disk.Name, vm.Hostname)
+	case disk.State != "created":
+		return nil, faultf(FaultConflict, "disk %s is %s", disk.Name, disk.State)
+	case position < 0 || position > len(s.attached[vm.ID]):
+		return nil, faultf(FaultInvalidParams, "position must be between 0 and %d", len(s.attached[vm.ID]))
+	case position == 0 && vm.State != "halted":
+		return nil, faultf(FaultConflict, "vm %s is %s, stop it to change its boot disk", vm.Hostname, vm.State)
+	}
+
+	return s.newOperation(gandi.OperationReturn{Type: "disk_attach", VMID: vm.ID, DiskID: disk.ID}, func() {
+		ids := s.attached[vm.ID]
+		if position > len(ids) {
+			position = len(ids)
+		}
+		ids = append(ids[:position], append([]int{disk.ID}, ids[position:]...)...)
+		s.attached[vm.ID] = ids
+		s.flagBootDisk(vm.ID)
+		disk.DateUpdated = s.now()
+	}), nil
+}
+
+func vmDiskDetach(s *Server, params []interface{}) (interface{}, *Fault) {
+	vmID, f := intParam(params, 0)
+	if f != nil {
+		return nil, f
+	}
+	vm, f := s.lookupVM(vmID)
+	if f != nil {
+		return nil, f
+	}
+	diskID, f := intParam(params, 1)
+	if f != nil {
+		return nil, f
+	}
+	disk, f := s.lookupDisk(diskID)
+	if f != nil {
+		return nil, f
+	}
+
+	if s.diskVM(disk.ID) != vm.ID {
+		return nil, faultf(FaultConflict, "disk %s is not attached to vm %s", disk.Name, vm.Hostname)
+	}
+	if disk.IsBootDisk && vm.State != "halted" {
+		return nil, faultf(FaultConflict, "vm %s is %s, stop it to detach its boot disk", vm.Hostname, vm.State)
+	}
+
+	return s.newOperation(gandi.OperationReturn{Type: "disk_detach", VMID: vm.ID, DiskID: disk.ID}, func() {
+		var ids []int
+		for _, id := range s.attached[vm.ID] {
+			if id != disk.ID {
+				ids = append(ids, id)
+			}
+		}
+		s.attached[vm.ID] = ids
+		s.flagBootDisk(vm.ID)
+		disk.IsBootDisk = false
+		disk.DateUpdated = s.now()
+	}), nil
+}
@@ -0,0 +1,98 @@
+// Copyright 2017, Carlo Strub <cs@carlostrub.ch>
+// BSD 3-Clause License, see LICENSE file for details.
+
+package fake_test
+
+import (
+	"testing"
+
+	"cost.li/bapu/gandi"
+	"cost.li/bapu/gandi/fake"
+)
+
+// createDisk creates an empty disk in Equinix Paris and waits until it is
+// created.
+func (f *fixture) createDisk(name string, size int) gandi.DiskReturn {
+	op, err := f.client.DiskCreate(gandi.DiskCreateSpec{DatacenterID: 1, Name: name, Size: size})
+	if err != nil {
+		f.t.Fatal(err)
+	}
+	op = f.wait(op)
+	if op.Type != "disk_create" || op.DiskID == 0 {
+		f.t.Fatalf("created with %+v", op)
+	}
+
+	disk, err := f.client.DiskInfo(op.DiskID)
+	if err != nil {
+		f.t.Fatal(err)
+	}
+
+	return disk
+}
+
+func TestDiskCreate(t *testing.T) {
+	withFake(t, func(f *fixture) {
+		disk := f.createDisk("data", 10240)
+		if disk.Name != "data" || disk.Size != 10240 || disk.State != "created" || len(disk.VMsID) != 0 {
+			t.Fatalf("created %+v", disk)
+		}
+
+		_, err := f.client.DiskCreate(gandi.DiskCreateSpec{DatacenterID: 1, Name: "data", Size: 10240})
+		wantFault(t, err, fake.FaultConflict)
+
+		_, err = f.client.DiskCreate(gandi.DiskCreateSpec{DatacenterID: 1, Name: "tiny", Size: 1})
+		wantFault(t, err, fake.FaultInvalidParams)
+
+		_, err = f.client.DiskCreate(gandi.DiskCreateSpec{DatacenterID: 42, Name: "nowhere", Size: 1024})
+		wantFault(t, err, fake.FaultNotFound)
+	})
+}
+
+func TestDiskAttach(t *testing.T) {
+	withFake(t, func(f *fixture) {
+		vm := f.createVM("db1")
+		disk := f.createDisk("data", 10240)
+
+		// Only halted machines can change their boot disk
+		_, err := f.client.VMDiskAttach(vm.ID, disk.ID, 0)
+		wantFault(t, err, fake.FaultConflict)
+
+		op, err := f.client.VMDiskAttach(vm.ID, disk.ID, 1)
+		if err != nil {
+			t.Fatal(err)
+		}
+		f.wait(op)
+
+		vm, err = f.client.VMInfo(vm.ID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(vm.Disks) != 2 || vm.Disks[1].ID != disk.ID || vm.Disks[1].IsBootDisk {
+			t.Fatalf("attached disks %+v", vm.Disks)
+		}
+		disk, err = f.client.DiskInfo(disk.ID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(disk.VMsID) != 1 || disk.VMsID[0] != vm.ID {
+			t.Fatalf("disk attached to %v", disk.VMsID)
+		}
+
+		_, err = f.client.VMDiskAttach(vm.ID, disk.ID, 1)
+		wantFault(t, err, fake.FaultConflict)
+
+		op, err = f.client.VMDiskDetach(vm.ID, disk.ID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		f.wait(op)
+
+		disk, err = f.client.DiskInfo(disk.ID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(disk.VMsID) != 0 {
+			t.Fatalf("detached disk still attached to %v", disk.VMsID)
+		}
+	})
+}
@@ -0,0 +1,98 @@
+// Copyright 2017, Carlo Strub <cs@carlostrub.ch>
+// BSD 3-Clause License, see LICENSE file for details.
+
+package fake
+
+import (
+	"cost.li/bapu/gandi"
+)
+
+// methods maps the XML-RPC method names to their implementation.
+var methods = map[string]method{
+	"hosting.account.info":         accountInfo,
+	"hosting.datacenter.list":      datacenterList,
+	"hosting.disk.create":          diskCreate,
+	"hosting.disk.create_from":     diskCreateFrom,
+	"hosting.disk.delete":          diskDelete,
+	"hosting.disk.info":            diskInfo,
+	"hosting.disk.list":            diskList,
+	"hosting.disk.list_kernels":    diskListKernels,
+	"hosting.disk.rollback_from":   diskRollbackFrom,
+	"hosting.disk.update":          diskUpdate,
+	"hosting.iface.create":         ifaceCreate,
+	"hosting.iface.delete":         ifaceDelete,
+	"hosting.iface.list":           ifaceList,
+	"hosting.image.list":           imageList,
+	"hosting.ip.list":              ipList,
+	"hosting.ip.update":            ipUpdate,
+	"hosting.snapshotprofile.list": snapshotProfileList,
+	"hosting.ssh.create":           sshCreate,
+	"hosting.ssh.delete":           sshDelete,
+	"hosting.ssh.info":             sshInfo,
+	"hosting.ssh.list":             sshList,
+	"hosting.vlan.create":          vlanCreate,
+	"hosting.vlan.delete":          vlanDelete,
+	"hosting.vlan.list":            vlanList,
+	"hosting.vlan.update":          vlanUpdate,
+	"hosting.vm.can_migrate":       vmCanMigrate,
+	"hosting.vm.count":             vmCount,
+	"hosting.vm.create_from":       vmCreateFrom,
+	"hosting.vm.delete":            vmDelete,
+	"hosting.vm.disk_attach":       vmDiskAttach,
+	"hosting.vm.disk_detach":       vmDiskDetach,
+	"hosting.vm.iface_attach":      vmIfaceAttach,
+	"hosting.vm.iface_detach":      vmIfaceDetach,
+	"hosting.vm.info":              vmInfo,
+	"hosting.vm.list":              vmList,
+	"hosting.vm.migrate":           vmMigrate,
+	"hosting.vm.reboot":            vmReboot,
+	"hosting.vm.start":             vmStart,
+	"hosting.vm.stop":              vmStop,
+	"hosting.vm.update":            vmUpdate,
+	"operation.info":               operationInfo,
+}
+
+func accountInfo(s *Server, params []interface{}) (interface{}, *Fault) {
+	return s.account, nil
+}
+
+func datacenterList(s *Server, params []interface{}) (interface{}, *Fault) {
+	return s.datacenters, nil
+}
+
+func imageList(s *Server, params []interface{}) (interface{}, *Fault) {
+	filter, f := mapParam(params, 0)
+	if f != nil {
+		return nil, f
+	}
+	dcID, filtered, f := intField(filter, "datacenter_id")
+	if f != nil {
+		return nil, f
+	}
+
+	images := []gandi.ImageReturn{}
+	for _, image := range s.images {
+		if !filtered || image.DatacenterID == dcID {
+			images = append(images, image)
+		}
+	}
+
+	return images, nil
+}
+
+func snapshotProfileList(s *Server, params []interface{}) (interface{}, *Fault) {
+	return s.profiles, nil
+}
+
+func operationInfo(s *Server, params []interface{}) (interface{}, *Fault) {
+	id, f := intParam(params, 0)
+	if f != nil {
+		return nil, f
+	}
+	op, ok := s.ops[id]
+	if !ok {
+		return nil, faultf(FaultNotFound, "operation %d not found", id)
+	}
+
+	return op.OperationReturn, nil
+}
@@ -0,0 +1,247 @@
+// Copyright 2017, Carlo Strub <cs@carlostrub.ch>
+// BSD 3-Clause License, see LICENSE file for details.
+
+package fake
+
+import (
+	"strings"
+
+	"cost.li/bapu/gandi"
+)
+
+// numberIfaces numbers the network interfaces of the virtual machine with
+// the given id in the order they were attached. The caller must hold s.mu.
+func (s *Server) numberIfaces(vmID int) {
+	num := 0
+	for _, id := range sortedIDs(s.ifaces) {
+		if iface := s.ifaces[id]; iface.VMID == vmID {
+			iface.Num = num
+			num++
+		}
+	}
+}
+
+func ifaceList(s *Server, params []interface{}) (interface{}, *Fault) {
+	ifaces := []gandi.IfaceReturn{}
+	for _, id := range sortedIDs(s.ifaces) {
+		ifaces = append(ifaces, s.withVLAN(*s.ifaces[id]))
+	}
+
+	return ifaces, nil
+}
+
+func ipList(s *Server, params []interface{}) (interface{}, *Fault) {
+	ips := []gandi.IPReturn{}
+	for _, id := range sortedIDs(s.ips) {
+		ips = append(ips, *s.ips[id])
+	}
+
+	return ips, nil
+}
+
+func ipUpdate(s *Server, params []interface{}) (interface{}, *Fault) {
+	id, f := intParam(params, 0)
+	if f != nil {
+		return nil, f
+	}
+	ip, ok := s.ips[id]
+	if !ok {
+		return nil, faultf(FaultNotFound, "ip %d not found", id)
+	}
+	update, f := mapParam(params, 1)
+	if f != nil {
+		return nil, f
+	}
+	reverse, hasReverse, f := stringField(update, "reverse")
+	if f != nil {
+		return nil, f
+	}
+	if !hasReverse {
+		reverse = ip.Reverse
+	}
+	if reverse == "" || strings.ContainsAny(reverse, " /@") {
+		return nil, faultf(FaultInvalidParams, "reverse %q is not a hostname", reverse)
+	}
+
+	return s.newOperation(gandi.OperationReturn{Type: "ip_update", IPID: ip.ID}, func() {
+		ip.Reverse = reverse
+		ip.DateUpdated = s.now()
+	}), nil
+}
+
+func ifaceCreate(s *Server, params []interface{}) (interface{}, *Fault) {
+	spec, f := mapParam(params, 0)
+	if f != nil {
+		return nil, f
+	}
+
+	dcID, _, f := intField(spec, "datacenter_id")
+	if f != nil {
+		return nil, f
+	}
+	dc, f := s.lookupDatacenter(dcID)
+	if f != nil {
+		return nil, f
+	}
+	vlanID, private, f := intField(spec, "vlan")
+	if f != nil {
+		return nil, f
+	}
+	ip, _, f := stringField(spec, "ip")
+	if f != nil {
+		return nil, f
+	}
+	version, _, f := intField(spec, "ip_version")
+	if f != nil {
+		return nil, f
+	}
+
+	typ := "public"
+	var vlan gandi.VLANReturn
+	if private {
+		v, f := s.lookupVLAN(vlanID)
+		if f != nil {
+			return nil, f
+		}
+		if v.DatacenterID != dc.ID {
+			return nil, faultf(FaultConflict, "vlan %s is not in %s", v.Name, dc.Name)
+		}
+		ip, f = s.vlanAddress(v, ip)
+		if f != nil {
+			return nil, f
+		}
+		typ, vlan, version = "private", *v, 4
+	} else {
+		if ip != "" {
+			return nil, faultf(FaultInvalidParams, "ip can only be chosen in a vlan")
+		}
+		if version != 4 && version != 6 {
+			return nil, faultf(FaultInvalidParams, "ip_version must be 4 or 6")
+		}
+		ip = s.newAddress(version)
+	}
+	bandwidth, hasBandwidth, f := floatField(spec, "bandwidth")
+	if f != nil {
+		return nil, f
+	}
+	if !hasBandwidth {
+		bandwidth = 102400
+	}
+	if bandwidth <= 0 {
+		return nil, faultf(FaultInvalidParams, "bandwidth must be positive")
+	}
+
+	iface := s.ifaces[s.addIface(0, gandi.IfaceReturn{
+		Bandwidth:    bandwidth,
+		DatacenterID: dc.ID,
+		Type:         typ,
+		VLAN:         vlan,
+	}).ID]
+	iface.State = "being_created"
+	addr := s.ips[s.addIP(iface.ID, gandi.IPReturn{IP: ip, Version: version}).ID]
+	addr.State = "being_created"
+
+	return s.newOperation(gandi.OperationReturn{Type: "iface_create", IfaceID: iface.ID, IPID: addr.ID}, func() {
+		iface.State = "free"
+		iface.DateUpdated = s.now()
+		addr.State = "created"
+		addr.DateUpdated = s.now()
+	}), nil
+}
+
+func ifaceDelete(s *Server, params []interface{}) (interface{}, *Fault) {
+	id, f := intParam(params, 0)
+	if f != nil {
+		return nil, f
+	}
+	iface, f := s.lookupIface(id)
+	if f != nil {
+		return nil, f
+	}
+	if iface.VMID != 0 {
+		return nil, faultf(FaultConflict, "iface %d is attached to vm %s", iface.ID, s.vms[iface.VMID].Hostname)
+	}
+	if iface.State != "free" {
+		return nil, faultf(FaultConflict, "iface %d is %s", iface.ID, iface.State)
+	}
+
+	iface.State = "deleting"
+
+	return s.newOperation(gandi.OperationReturn{Type: "iface_delete", IfaceID: iface.ID}, func() {
+		for ipID, ip := range s.ips {
+			if ip.IfaceID == iface.ID {
+				delete(s.ips, ipID)
+			}
+		}
+		delete(s.ifaces, iface.ID)
+	}), nil
+}
+
+func vmIfaceAttach(s *Server, params []interface{}) (interface{}, *Fault) {
+	vmID, f := intParam(params, 0)
+	if f != nil {
+		return nil, f
+	}
+	vm, f := s.lookupVM(vmID)
+	if f != nil {
+		return nil, f
+	}
+	ifaceID, f := intParam(params, 1)
+	if f != nil {
+		return nil, f
+	}
+	iface, f := s.lookupIface(ifaceID)
+	if f != nil {
+		return nil, f
+	}
+
+	switch {
+	case iface.VMID != 0:
+		return nil, faultf(FaultConflict, "iface %d is attached to vm %s", iface.ID, s.vms[iface.VMID].Hostname)
+	case iface.State != "free":
+		return nil, faultf(FaultConflict, "iface %d is %s", iface.ID, iface.State)
+	case iface.DatacenterID != vm.DatacenterID:
+		return nil, faultf(FaultConflict, "iface %d and vm %s are in different datacenters", iface.ID, vm.Hostname)
+	}
+
+	iface.State = "being_attached"
+
+	return s.newOperation(gandi.OperationReturn{Type: "iface_attach", VMID: vm.ID, IfaceID: iface.ID}, func() {
+		iface.VMID = vm.ID
+		iface.State = "used"
+		iface.DateUpdated = s.now()
+		s.numberIfaces(vm.ID)
+	}), nil
+}
+
+func vmIfaceDetach(s *Server, params []interface{}) (interface{}, *Fault) {
+	vmID, f := intParam(params, 0)
+	if f != nil {
+		return nil, f
+	}
+	vm, f := s.lookupVM(vmID)
+	if f != nil {
+		return nil, f
+	}
+	ifaceID, f := intParam(params, 1)
+	if f != nil {
+		return nil, f
+	}
+	iface, f := s.lookupIface(ifaceID)
+	if f != nil {
+		return nil, f
+	}
+	if iface.VMID != vm.ID {
+		return nil, faultf(FaultConflict, "iface %d is not attached to vm %s", iface.ID, vm.Hostname)
+	}
+
+	iface.State = "being_detached"
+
+	return s.newOperation(gandi.OperationReturn{Type: "iface_detach", VMID: vm.ID, IfaceID: iface.ID}, func() {
+		iface.VMID = 0
+		iface.Num = 0
+		iface.State = "free"
+		iface.DateUpdated = s.now()
+		s.numberIfaces(vm.ID)
+	}), nil
+}
@@ -0,0 +1,88 @@
+// Copyright 2017, Carlo Strub <cs@carlostrub.ch>
+// BSD 3-Clause License, see LICENSE file for details.
+
+package fake_test
+
+import (
+	"testing"
+
+	"cost.li/bapu/gandi"
+	"cost.li/bapu/gandi/fake"
+)
+
+// iface returns the network interface with the given id from the list.
+func (f *fixture) iface(id int) gandi.IfaceReturn {
+	ifaces, err := f.client.IfaceList()
+	if err != nil {
+		f.t.Fatal(err)
+	}
+	for _, iface := range ifaces {
+		if iface.ID == id {
+			return iface
+		}
+	}
+	f.t.Fatalf("iface %d not listed", id)
+
+	return gandi.IfaceReturn{}
+}
+
+func TestIfaceCreateAttach(t *testing.T) {
+	withFake(t, func(f *fixture) {
+		vm := f.createVM("mail")
+
+		op, err := f.client.IfaceCreate(gandi.IfaceCreateSpec{DatacenterID: 1, IPVersion: 4})
+		if err != nil {
+			t.Fatal(err)
+		}
+		op = f.wait(op)
+		if op.Type != "iface_create" || op.IfaceID == 0 || op.IPID == 0 {
+			t.Fatalf("created with %+v", op)
+		}
+
+		iface := f.iface(op.IfaceID)
+		if iface.State != "free" || iface.VMID != 0 || iface.Type != "public" {
+			t.Fatalf("created %+v", iface)
+		}
+		ips, err := f.client.IPList()
+		if err != nil {
+			t.Fatal(err)
+		}
+		found := false
+		for _, ip := range ips {
+			if ip.ID == op.IPID {
+				found = ip.IfaceID == iface.ID && ip.Version == 4 && ip.State == "created"
+			}
+		}
+		if !found {
+			t.Fatalf("no IPv4 address of iface %d among %+v", iface.ID, ips)
+		}
+
+		_, err = f.client.IfaceCreate(gandi.IfaceCreateSpec{DatacenterID: 1, IPVersion: 5})
+		wantFault(t, err, fake.FaultInvalidParams)
+
+		op, err = f.client.VMIfaceAttach(vm.ID, iface.ID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		f.wait(op)
+
+		iface = f.iface(iface.ID)
+		if iface.State != "used" || iface.VMID != vm.ID {
+			t.Fatalf("attached %+v", iface)
+		}
+		vm, err = f.client.VMInfo(vm.ID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(vm.Ifaces) != 2 {
+			t.Fatalf("vm has ifaces %+v", vm.Ifaces)
+		}
+
+		_, err = f.client.VMIfaceAttach(vm.ID, iface.ID)
+		wantFault(t, err, fake.FaultConflict)
+
+		// Attached interfaces cannot be deleted
+		_, err = f.client.IfaceDelete(iface.ID)
+		wantFault(t, err, fake.FaultConflict)
+	})
+}
@@ -0,0 +1,759 @@
+// Copyright 2017, Carlo Strub <cs@carlostrub.ch>
+// BSD 3-Clause License, see LICENSE file for details.
+
+// Package fake implements an in-process fake of the Gandi hosting XML-RPC
+// API. It keeps a stateful in-memory model of the account so that bapu can
+// be developed and tested without network access.
+//
+// A Server is an http.Handler and can be served with net/http/httptest or
+// with Listen:
+//
+//	srv := fake.NewDemoServer()
+//	url, err := srv.Listen("127.0.0.1:0")
+//	client, err := gandi.NewClient(url, "any key")
+package fake
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"reflect"
+	"sort"
+	"sync"
+	"time"
+
+	"cost.li/bapu/gandi"
+)
+
+// Fault codes returned by the fake
+const (
+	FaultMethodNotFound = -32601
+	FaultInvalidParams  = -32602
+	FaultUnauthorized   = 401
+	FaultNotFound       = 404
+	FaultConflict       = 409
+)
+
+// Fault is an XML-RPC fault returned by a fake method.
+type Fault struct {
+	Code    int
+	Message string
+}
+
+// Error implements the error interface.
+func (f *Fault) Error() string {
+	return fmt.Sprintf("%s (fault %d)", f.Message, f.Code)
+}
+
+func faultf(code int, format string, a ...interface{}) *Fault {
+	return &Fault{
+		Code:    code,
+		Message: fmt.Sprintf(format, a...),
+	}
+}
+
+// method implements an API method. params do not include the API key.
+type method func(s *Server, params []interface{}) (interface{}, *Fault)
+
+// operation is an operation in progress. apply is run once the operation is
+// done.
+type operation struct {
+	gandi.OperationReturn
+	done  time.Time
+	apply func()
+}
+
+// Server is a fake Gandi hosting API.
+type Server struct {
+	// APIKey is the key every call must be authenticated with. An empty
+	// APIKey accepts any key.
+	APIKey string
+
+	// Delay is the time an operation takes from its creation until it is
+	// done.
+	Delay time.Duration
+
+	// Clock returns the current time. It defaults to time.Now and may be
+	// replaced to advance operations without waiting for them.
+	Clock func() time.Time
+
+	mu          sync.Mutex
+	nextID      int
+	datacenters []gandi.DatacenterReturn
+	images      []gandi.ImageReturn
+	profiles    []gandi.SnapshotProfileReturn
+	kernels     map[int]map[string][]string // datacenter id to its kernels by family
+	account     gandi.AccountReturn
+	vms         map[int]*gandi.VMReturn
+	disks       map[int]*gandi.DiskReturn
+	attached    map[int][]int // VM id to the ids of its disks, in position order
+	ifaces      map[int]*gandi.IfaceReturn
+	ips         map[int]*gandi.IPReturn
+	vlans       map[int]*gandi.VLANReturn
+	keys        map[int]*gandi.SSHKeyReturn
+	ops         map[int]*operation
+	migrations  map[int]int // VM id to the datacenter its disks were copied to
+}
+
+// NewServer returns a fake with Gandi's datacenters and a few public images
+// but an empty account.
+func NewServer() *Server {
+	s := &Server{
+		Delay:      2 * time.Second,
+		Clock:      time.Now,
+		nextID:     1000,
+		vms:        make(map[int]*gandi.VMReturn),
+		disks:      make(map[int]*gandi.DiskReturn),
+		attached:   make(map[int][]int),
+		ifaces:     make(map[int]*gandi.IfaceReturn),
+		ips:        make(map[int]*gandi.IPReturn),
+		vlans:      make(map[int]*gandi.VLANReturn),
+		keys:       make(map[int]*gandi.SSHKeyReturn),
+		ops:        make(map[int]*operation),
+		migrations: make(map[int]int),
+	}
+
+	s.datacenters = []gandi.DatacenterReturn{
+		{ID: 1, ISO: "FR", Name: "Equinix Paris", Country: "France", DCCode: "FR-SD2"},
+		{ID: 2, ISO: "US", Name: "Level3 Baltimore", Country: "United States of America", DCCode: "US-BA1"},
+		{ID: 3, ISO: "LU", Name: "Bissen", Country: "Luxembourg", DCCode: "LU-BI1"},
+	}
+
+	s.kernels = make(map[int]map[string][]string)
+	for _, dc := range s.datacenters {
+		s.kernels[dc.ID] = map[string][]string{
+			"linux-hvm": {"3.12-x86_64 (hvm)", "3.18-x86_64 (hvm)", "4.4-x86_64 (hvm)"},
+			"raw":       {"grub (hvm)", "raw (hvm)"},
+		}
+	}
+	// Bissen lags behind
+	s.kernels[3]["linux-hvm"] = s.kernels[3]["linux-hvm"][:2]
+
+	imageID := 1
+	for _, dc := range s.datacenters {
+		for _, label := range []string{"Debian 8 64 bits (HVM)", "Ubuntu 16.04 64 bits LTS (HVM)"} {
+			s.images = append(s.images, gandi.ImageReturn{
+				DatacenterID:  dc.ID,
+				DiskID:        100 + imageID,
+				ID:            imageID,
+				KernelVersion: "3.12-x86_64 (hvm)",
+				Label:         label,
+				OSArch:        "x86-64",
+				Size:          3072,
+				Visibility:    "all",
+			})
+			imageID++
+		}
+	}
+
+	s.profiles = []gandi.SnapshotProfileReturn{
+		{ID: 1, Name: "minimal", KeptTotal: 2, QuotaFactor: 1.2, Schedules: []gandi.SnapshotScheduleReturn{
+			{Name: "daily", KeptVersion: 2},
+		}},
+		{ID: 2, Name: "full_week", KeptTotal: 7, QuotaFactor: 1.7, Schedules: []gandi.SnapshotScheduleReturn{
+			{Name: "daily", KeptVersion: 7},
+		}},
+		{ID: 3, Name: "security", KeptTotal: 14, QuotaFactor: 2, Schedules: []gandi.SnapshotScheduleReturn{
+			{Name: "hourly", KeptVersion: 6},
+			{Name: "daily", KeptVersion: 6},
+			{Name: "weekly", KeptVersion: 2},
+		}},
+	}
+
+	return s
+}
+
+// NewDemoServer returns a fake populated with a demo account and a few
+// virtual machines in different states.
+func NewDemoServer() *Server {
+	s := NewServer()
+
+	s.SetAccount(gandi.AccountReturn{
+		AverageCreditCost:     5.25,
+		Credits:               5000,
+		CycleDay:              1,
+		DateCreditsExpiration: time.Now().AddDate(1, 0, 0),
+		FullName:              "Demo Account",
+		Handle:                "DEMO-GANDI",
+	})
+
+	s.AddSSHKey(gandi.SSHKeyReturn{
+		Name:  "demo",
+		Value: "ssh-ed25519 AAAAC3NzaC1lZDI1NTE5AAAAIKSpNW/NacllSdf8dqFUF9+IRbvOz1ZMh1xKPcRii69i demo@example.net",
+	})
+
+	backend := s.AddVLAN(gandi.VLANReturn{
+		DatacenterID: 1,
+		Name:         "backend",
+		Subnet:       "10.0.0.0/24",
+		Gateway:      "10.0.0.1",
+	})
+
+	for i, vm := range []gandi.VMReturn{
+		{Hostname: "web1", Description: "Web server", DatacenterID: 1, Cores: 2, Memory: 2048, State: "running"},
+		{Hostname: "db1", Description: "Database", DatacenterID: 1, Cores: 4, Memory: 4096, State: "halted"},
+		{Hostname: "mail", Description: "Mail server", DatacenterID: 3, Cores: 1, Memory: 1024, State: "paused"},
+	} {
+		vm = s.AddVM(vm)
+		sys := gandi.DiskReturn{
+			Name:          "sys_" + vm.Hostname,
+			Size:          10240,
+			KernelVersion: "3.12-x86_64 (hvm)",
+			Label:         "Debian 8 64 bits (HVM)",
+		}
+		if vm.Hostname == "web1" {
+			sys.SnapshotProfile = s.profiles[0]
+		}
+		sys = s.AddDisk(vm.ID, sys)
+		if vm.Hostname == "db1" {
+			s.AddDisk(vm.ID, gandi.DiskReturn{Name: "db1_data", Size: 51200})
+		}
+		if vm.Hostname == "web1" {
+			s.AddDisk(0, gandi.DiskReturn{Name: "old_backup", Size: 20480, DatacenterID: vm.DatacenterID})
+			s.AddDisk(0, gandi.DiskReturn{
+				Name:          "sys_web1_daily",
+				Size:          sys.Size,
+				DatacenterID:  sys.DatacenterID,
+				KernelVersion: sys.KernelVersion,
+				Label:         sys.Label,
+				Source:        sys.ID,
+				Type:          "snapshot",
+			})
+		}
+
+		iface := s.AddIface(vm.ID, gandi.IfaceReturn{Bandwidth: 102400})
+		s.AddIP(iface.ID, gandi.IPReturn{
+			IP:      fmt.Sprintf("203.0.113.%d", 10+i),
+			Reverse: vm.Hostname + ".example.net",
+			Version: 4,
+		})
+		s.AddIP(iface.ID, gandi.IPReturn{
+			IP:      fmt.Sprintf("2001:db8::%x", 10+i),
+			Reverse: vm.Hostname + ".example.net",
+			Version: 6,
+		})
+
+		if vm.DatacenterID == backend.DatacenterID {
+			private := s.AddIface(vm.ID, gandi.IfaceReturn{Bandwidth: 204800, Type: "private", VLAN: backend})
+			s.AddIP(private.ID, gandi.IPReturn{IP: fmt.Sprintf("10.0.0.%d", 10+i), Version: 4})
+		}
+	}
+
+	// An address kept from a machine deleted long ago
+	spare := s.AddIface(0, gandi.IfaceReturn{Bandwidth: 102400, DatacenterID: 1})
+	s.AddIP(spare.ID, gandi.IPReturn{IP: "203.0.113.50", Version: 4})
+
+	return s
+}
+
+// SetAccount sets the account returned by hosting.account.info.
+func (s *Server) SetAccount(account gandi.AccountReturn) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if account.ID == 0 {
+		account.ID = s.newID()
+	}
+	s.account = account
+}
+
+// AddVM adds vm to the model and returns it with its id and defaults set.
+func (s *Server) AddVM(vm gandi.VMReturn) gandi.VMReturn {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.addVM(vm)
+}
+
+// addVM implements AddVM. The caller must hold s.mu.
+func (s *Server) addVM(vm gandi.VMReturn) gandi.VMReturn {
+	if vm.ID == 0 {
+		vm.ID = s.newID()
+	}
+	if vm.State == "" {
+		vm.State = "halted"
+	}
+	if vm.VMmaxMemory == 0 {
+		vm.VMmaxMemory = 8192
+	}
+	if vm.HVMState == "" {
+		vm.HVMState = "unknown"
+	}
+	if vm.DateCreated.IsZero() {
+		vm.DateCreated = s.now()
+	}
+	vm.DateUpdated = vm.DateCreated
+	vm.Disks = nil
+
+	s.vms[vm.ID] = &vm
+
+	return vm
+}
+
+// AddDisk adds disk to the model and returns it with its id and defaults
+// set. If vmID is not 0, the disk is attached to that virtual machine; the
+// first disk attached to a machine is its boot disk.
+func (s *Server) AddDisk(vmID int, disk gandi.DiskReturn) gandi.DiskReturn {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.addDisk(vmID, disk)
+}
+
+// addDisk implements AddDisk. The caller must hold s.mu.
+func (s *Server) addDisk(vmID int, disk gandi.DiskReturn) gandi.DiskReturn {
+	if disk.ID == 0 {
+		disk.ID = s.newID()
+	}
+	if disk.State == "" {
+		disk.State = "created"
+	}
+	if disk.Type == "" {
+		disk.Type = "data"
+	}
+	if disk.Visibility == "" {
+		disk.Visibility = "private"
+	}
+	disk.CanSnapshot = disk.Type != "snapshot"
+	if disk.DateCreated.IsZero() {
+		disk.DateCreated = s.now()
+	}
+	disk.DateUpdated = disk.DateCreated
+	disk.TotalSize = disk.Size
+
+	if vm, ok := s.vms[vmID]; ok {
+		disk.DatacenterID = vm.DatacenterID
+		disk.IsBootDisk = len(s.attached[vmID]) == 0
+		s.attached[vmID] = append(s.attached[vmID], disk.ID)
+	}
+
+	s.disks[disk.ID] = &disk
+
+	return disk
+}
+
+// AddIface adds iface to the model and returns it with its id and defaults
+// set. If vmID is not 0, the interface is attached to that virtual machine.
+func (s *Server) AddIface(vmID int, iface gandi.IfaceReturn) gandi.IfaceReturn {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.addIface(vmID, iface)
+}
+
+// addIface implements AddIface. The caller must hold s.mu.
+func (s *Server) addIface(vmID int, iface gandi.IfaceReturn) gandi.IfaceReturn {
+	if iface.ID == 0 {
+		iface.ID = s.newID()
+	}
+	if iface.Type == "" {
+		iface.Type = "public"
+	}
+	if iface.DateCreated.IsZero() {
+		iface.DateCreated = s.now()
+	}
+	iface.DateUpdated = iface.DateCreated
+	iface.IPs = nil
+	iface.State = "free"
+
+	if vm, ok := s.vms[vmID]; ok {
+		iface.DatacenterID = vm.DatacenterID
+		iface.VMID = vm.ID
+		iface.State = "used"
+		for _, other := range s.ifaces {
+			if other.VMID == vm.ID {
+				iface.Num++
+			}
+		}
+	}
+
+	s.ifaces[iface.ID] = &iface
+
+	return iface
+}
+
+// AddVLAN adds vlan to the model and returns it with its id and defaults
+// set.
+func (s *Server) AddVLAN(vlan gandi.VLANReturn) gandi.VLANReturn {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.addVLAN(vlan)
+}
+
+// addVLAN implements AddVLAN. The caller must hold s.mu.
+func (s *Server) addVLAN(vlan gandi.VLANReturn) gandi.VLANReturn {
+	if vlan.ID == 0 {
+		vlan.ID = s.newID()
+	}
+	if vlan.UUID == 0 {
+		vlan.UUID = vlan.ID
+	}
+	if vlan.State == "" {
+		vlan.State = "created"
+	}
+
+	s.vlans[vlan.ID] = &vlan
+
+	return vlan
+}
+
+// AddSSHKey adds key to the model and returns it with its id and
+// fingerprint set.
+func (s *Server) AddSSHKey(key gandi.SSHKeyReturn) gandi.SSHKeyReturn {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.addSSHKey(key)
+}
+
+// addSSHKey implements AddSSHKey. The caller must hold s.mu.
+func (s *Server) addSSHKey(key gandi.SSHKeyReturn) gandi.SSHKeyReturn {
+	if key.ID == 0 {
+		key.ID = s.newID()
+	}
+	if key.Fingerprint == "" {
+		key.Fingerprint, _ = gandi.SSHFingerprint(key.Value)
+	}
+
+	s.keys[key.ID] = &key
+
+	return key
+}
+
+// AddIP adds ip to the model, bound to the interface with the given id, and
+// returns it with its id and defaults set.
+func (s *Server) AddIP(ifaceID int, ip gandi.IPReturn) gandi.IPReturn {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.addIP(ifaceID, ip)
+}
+
+// addIP implements AddIP. The caller must hold s.mu.
+func (s *Server) addIP(ifaceID int, ip gandi.IPReturn) gandi.IPReturn {
+	if ip.ID == 0 {
+		ip.ID = s.newID()
+	}
+	if ip.Version == 0 {
+		ip.Version = 4
+	}
+	if ip.DateCreated.IsZero() {
+		ip.DateCreated = s.now()
+	}
+	ip.DateUpdated = ip.DateCreated
+	ip.State = "created"
+
+	if iface, ok := s.ifaces[ifaceID]; ok {
+		ip.DatacenterID = iface.DatacenterID
+		ip.IfaceID = iface.ID
+		for _, other := range s.ips {
+			if other.IfaceID == iface.ID {
+				ip.Num++
+			}
+		}
+	}
+
+	s.ips[ip.ID] = &ip
+
+	return ip
+}
+
+// Listen serves the fake on addr, e.g. "127.0.0.1:0", in the background and
+// returns the URL of its endpoint.
+func (s *Server) Listen(addr string) (url string, err error) {
+	l, err := net.Listen("tcp", addr)
+	if err != nil {
+		return "", err
+	}
+
+	go http.Serve(l, s)
+
+	return "http://" + l.Addr().String() + "/xmlrpc/", nil
+}
+
+// ServeHTTP implements http.Handler.
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "POST" {
+		http.Error(w, "only POST is supported", http.StatusMethodNotAllowed)
+		return
+	}
+
+	name, params, err := decodeCall(r.Body)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/xml")
+
+	result, fault := s.call(name, params)
+	if fault != nil {
+		encodeFault(w, fault)
+		return
+	}
+
+	encodeResponse(w, result)
+}
+
+// call authenticates and dispatches a single method call.
+func (s *Server) call(name string, params []interface{}) (interface{}, *Fault) {
+	m, ok := methods[name]
+	if !ok {
+		return nil, faultf(FaultMethodNotFound, "method %s not found", name)
+	}
+
+	if len(params) == 0 {
+		return nil, faultf(FaultUnauthorized, "missing API key")
+	}
+	key, ok := params[0].(string)
+	if !ok || (s.APIKey != "" && key != s.APIKey) {
+		return nil, faultf(FaultUnauthorized, "invalid API key")
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.settle()
+
+	return m(s, params[1:])
+}
+
+// now returns the current time at the precision XML-RPC transports.
+func (s *Server) now() time.Time {
+	return s.Clock().Truncate(time.Second)
+}
+
+func (s *Server) newID() int {
+	id := s.nextID
+	s.nextID++
+
+	return id
+}
+
+// newAddress returns an unused IP address of the given version from the
+// documentation ranges. The caller must hold s.mu.
+func (s *Server) newAddress(version int) string {
+	for n := 10; ; n++ {
+		ip := fmt.Sprintf("203.0.113.%d", n)
+		if version == 6 {
+			ip = fmt.Sprintf("2001:db8::%x", n)
+		}
+
+		used := false
+		for _, other := range s.ips {
+			if other.IP == ip {
+				used = true
+			}
+		}
+		if !used {
+			return ip
+		}
+	}
+}
+
+// newOperation registers op, of which the caller sets the type and the ids
+// of the objects it acts on. apply is run once the operation is done. The
+// caller must hold s.mu.
+func (s *Server) newOperation(op gandi.OperationReturn, apply func()) gandi.OperationReturn {
+	now := s.now()
+
+	op.DateCreated = now
+	op.DateUpdated = now
+	op.ID = s.newID()
+	op.Source = s.account.Handle
+	op.Step = gandi.StepWait
+
+	s.ops[op.ID] = &operation{
+		OperationReturn: op,
+		done:            s.Clock().Add(s.Delay),
+		apply:           apply,
+	}
+
+	if s.Delay == 0 {
+		s.settle()
+	}
+
+	return s.ops[op.ID].OperationReturn
+}
+
+// settle advances all operations according to the time passed since their
+// creation. The caller must hold s.mu.
+func (s *Server) settle() {
+	now := s.Clock()
+
+	// Apply operations in the order they were created
+	var ids []int
+	for id, op := range s.ops {
+		if !op.Finished() {
+			ids = append(ids, id)
+		}
+	}
+	sort.Ints(ids)
+
+	for _, id := range ids {
+		op := s.ops[id]
+
+		switch {
+		case !now.Before(op.done):
+			if op.apply != nil {
+				op.apply()
+			}
+			op.Step = gandi.StepDone
+			op.DateStart = op.DateCreated
+			op.DateUpdated = s.now()
+		case op.Step == gandi.StepWait && now.After(op.done.Add(-s.Delay/2)):
+			op.Step = gandi.StepRun
+			op.DateStart = s.now()
+			op.DateUpdated = op.DateStart
+		}
+	}
+}
+
+// sortedIDs returns the keys of m, a map with int keys, in ascending order.
+func sortedIDs(m interface{}) []int {
+	var ids []int
+	for _, k := range reflect.ValueOf(m).MapKeys() {
+		ids = append(ids, int(k.Int()))
+	}
+	sort.Ints(ids)
+
+	return ids
+}
+
+// lookupVM returns the virtual machine with the given id. The caller must
+// hold s.mu.
+func (s *Server) lookupVM(id int) (*gandi.VMReturn, *Fault) {
+	vm, ok := s.vms[id]
+	if !ok || vm.State == "deleted" {
+		return nil, faultf(FaultNotFound, "vm %d not found", id)
+	}
+
+	return vm, nil
+}
+
+// lookupDisk returns the disk with the given id. The caller must hold s.mu.
+func (s *Server) lookupDisk(id int) (*gandi.DiskReturn, *Fault) {
+	disk, ok := s.disks[id]
+	if !ok || disk.State == "deleted" {
+		return nil, faultf(FaultNotFound, "disk %d not found", id)
+	}
+
+	return disk, nil
+}
+
+// lookupDatacenter returns the datacenter with the given id. The caller must
+// hold s.mu.
+func (s *Server) lookupDatacenter(id int) (gandi.DatacenterReturn, *Fault) {
+	for _, dc := range s.datacenters {
+		if dc.ID == id {
+			return dc, nil
+		}
+	}
+
+	return gandi.DatacenterReturn{}, faultf(FaultNotFound, "datacenter %d not found", id)
+}
+
+// lookupIface returns the network interface with the given id. The caller
+// must hold s.mu.
+func (s *Server) lookupIface(id int) (*gandi.IfaceReturn, *Fault) {
+	iface, ok := s.ifaces[id]
+	if !ok {
+		return nil, faultf(FaultNotFound, "iface %d not found", id)
+	}
+
+	return iface, nil
+}
+
+// intParam returns the i-th parameter as int.
+func intParam(params []interface{}, i int) (int, *Fault) {
+	if i >= len(params) {
+		return 0, faultf(FaultInvalidParams, "missing parameter %d", i+1)
+	}
+
+	v, ok := params[i].(int)
+	if !ok {
+		return 0, faultf(FaultInvalidParams, "parameter %d must be an int", i+1)
+	}
+
+	return v, nil
+}
+
+// boolParam returns the i-th parameter as bool. A missing parameter is
+// returned as false.
+func boolParam(params []interface{}, i int) (bool, *Fault) {
+	if i >= len(params) {
+		return false, nil
+	}
+
+	v, ok := params[i].(bool)
+	if !ok {
+		return false, faultf(FaultInvalidParams, "parameter %d must be a boolean", i+1)
+	}
+
+	return v, nil
+}
+
+// mapParam returns the i-th parameter as struct. A missing parameter is
+// returned as empty struct.
+func mapParam(params []interface{}, i int) (map[string]interface{}, *Fault) {
+	if i >= len(params) {
+		return map[string]interface{}{}, nil
+	}
+
+	v, ok := params[i].(map[string]interface{})
+	if !ok {
+		return nil, faultf(FaultInvalidParams, "parameter %d must be a struct", i+1)
+	}
+
+	return v, nil
+}
+
+// intField returns the member key of m as int and whether it is present.
+func intField(m map[string]interface{}, key string) (int, bool, *Fault) {
+	v, ok := m[key]
+	if !ok {
+		return 0, false, nil
+	}
+
+	i, ok := v.(int)
+	if !ok {
+		return 0, false, faultf(FaultInvalidParams, "%s must be an int", key)
+	}
+
+	return i, true, nil
+}
+
+// floatField returns the member key of m as float64 and whether it is
+// present. Ints are accepted as well.
+func floatField(m map[string]interface{}, key string) (float64, bool, *Fault) {
+	v, ok := m[key]
+	if !ok {
+		return 0, false, nil
+	}
+
+	switch f := v.(type) {
+	case float64:
+		return f, true, nil
+	case int:
+		return float64(f), true, nil
+	}
+
+	return 0, false, faultf(FaultInvalidParams, "%s must be a double", key)
+}
+
+// stringField returns the member key of m as string and whether it is
+// present.
+func stringField(m map[string]interface{}, key string) (string, bool, *Fault) {
+	v, ok := m[key]
+	if !ok {
+		return "", false, nil
+	}
+
+	str, ok := v.(string)
+	if !ok {
+		return "", false, faultf(FaultInvalidParams, "%s must be a string", key)
+	}
+
+	return str, true, nil
+}
@@ -0,0 +1,208 @@
+// Copyright 2017, Carlo Strub <cs@carlostrub.ch>
+// BSD 3-Clause License, see LICENSE file for details.
+
+package fake_test
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"cost.li/bapu/gandi"
+	"cost.li/bapu/gandi/fake"
+)
+
+// fixture is a fake with an empty account, served over HTTP, and a client
+// for it. The clock of the fake only moves when advanced, and operations
+// are done at once unless srv.Delay is raised.
+type fixture struct {
+	t      *testing.T
+	srv    *fake.Server
+	url    string
+	client *gandi.Client
+
+	mu  sync.Mutex
+	now time.Time
+}
+
+// withFake runs test against a fresh fixture and shuts it down afterwards.
+func withFake(t *testing.T, test func(f *fixture)) {
+	f := &fixture{
+		t:   t,
+		srv: fake.NewServer(),
+		now: time.Date(2017, 6, 1, 12, 0, 0, 0, time.UTC),
+	}
+	f.srv.Delay = 0
+	f.srv.Clock = f.clock
+
+	ts := httptest.NewServer(f.srv)
+	defer ts.Close()
+	f.url = ts.URL
+
+	var err error
+	f.client, err = gandi.NewClient(ts.URL, "any key")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	test(f)
+}
+
+func (f *fixture) clock() time.Time {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	return f.now
+}
+
+// advance moves the clock of the fake forward by d.
+func (f *fixture) advance(d time.Duration) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.now = f.now.Add(d)
+}
+
+// wait lets the time of srv.Delay pass and fails unless op is done then.
+func (f *fixture) wait(op gandi.OperationReturn) gandi.OperationReturn {
+	f.advance(f.srv.Delay)
+
+	op, err := f.client.OperationInfo(op.ID)
+	if err != nil {
+		f.t.Fatal(err)
+	}
+	if op.Step != gandi.StepDone {
+		f.t.Fatalf("operation %d %s ended with %s: %s", op.ID, op.Type, op.Step, op.LastError)
+	}
+
+	return op
+}
+
+// rawCall calls method with a single string parameter after the API key,
+// which gandi.Client cannot do, and returns the response.
+func (f *fixture) rawCall(method, param string) string {
+	body := `<?xml version="1.0"?><methodCall><methodName>` + method + `</methodName><params>` +
+		`<param><value><string>any key</string></value></param>` +
+		`<param><value><string>` + param + `</string></value></param>` +
+		`</params></methodCall>`
+	resp, err := http.Post(f.url, "text/xml", strings.NewReader(body))
+	if err != nil {
+		f.t.Fatal(err)
+	}
+	defer resp.Body.Close()
+
+	reply, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		f.t.Fatal(err)
+	}
+
+	return string(reply)
+}
+
+// wantFault fails unless err is a fault with the given code.
+func wantFault(t *testing.T, err error, code int) {
+	fault, ok := err.(*gandi.Fault)
+	if !ok {
+		t.Fatalf("got error %v, want fault %d", err, code)
+	}
+	if fault.Code != code {
+		t.Fatalf("got fault %d %q, want fault %d", fault.Code, fault.Message, code)
+	}
+}
+
+func TestFaults(t *testing.T) {
+	withFake(t, func(f *fixture) {
+		_, err := f.client.VMInfo(1)
+		wantFault(t, err, fake.FaultNotFound)
+
+		_, err = f.client.OperationInfo(1)
+		wantFault(t, err, fake.FaultNotFound)
+
+		vm := f.srv.AddVM(gandi.VMReturn{Hostname: "web1", DatacenterID: 1, State: "running"})
+		_, err = f.client.VMStart(vm.ID)
+		wantFault(t, err, fake.FaultConflict)
+
+		f.srv.APIKey = "secret"
+		_, err = f.client.AccountInfo()
+		wantFault(t, err, fake.FaultUnauthorized)
+		f.srv.APIKey = ""
+
+		for _, c := range []struct {
+			method string
+			code   string
+		}{
+			{"hosting.nonsense", "-32601"},
+			{"hosting.vm.info", "-32602"},
+		} {
+			reply := f.rawCall(c.method, "not an id")
+			if !strings.Contains(reply, "<fault>") || !strings.Contains(reply, c.code) {
+				t.Errorf("%s answered with %s, want fault %s", c.method, reply, c.code)
+			}
+		}
+	})
+}
+
+func TestOperationProgress(t *testing.T) {
+	withFake(t, func(f *fixture) {
+		f.srv.Delay = time.Minute
+		vm := f.srv.AddVM(gandi.VMReturn{Hostname: "web1", DatacenterID: 1, Cores: 1, Memory: 512})
+
+		op, err := f.client.VMStart(vm.ID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if op.Type != "vm_start" || op.VMID != vm.ID || op.Step != gandi.StepWait {
+			t.Fatalf("started with %+v", op)
+		}
+
+		for _, step := range []struct {
+			after time.Duration
+			step  string
+			state string
+		}{
+			{20 * time.Second, gandi.StepWait, "halted"},
+			{20 * time.Second, gandi.StepRun, "halted"},
+			{20 * time.Second, gandi.StepDone, "running"},
+		} {
+			f.advance(step.after)
+
+			op, err = f.client.OperationInfo(op.ID)
+			if err != nil {
+				t.Fatal(err)
+			}
+			vm, err = f.client.VMInfo(vm.ID)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if op.Step != step.step || vm.State != step.state {
+				t.Fatalf("got step %s with vm %s, want %s with vm %s", op.Step, vm.State, step.step, step.state)
+			}
+		}
+	})
+}
+
+func TestVMList(t *testing.T) {
+	withFake(t, func(f *fixture) {
+		web := f.srv.AddVM(gandi.VMReturn{Hostname: "web1", DatacenterID: 1, State: "running"})
+		db := f.srv.AddVM(gandi.VMReturn{Hostname: "db1", DatacenterID: 3})
+
+		vms, err := f.client.VMList()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(vms) != 2 || vms[0].ID != web.ID || vms[1].ID != db.ID || vms[1].State != "halted" {
+			t.Fatalf("listed %+v", vms)
+		}
+		count, err := f.client.VMCount()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if count != 2 {
+			t.Fatalf("counted %d virtual machines", count)
+		}
+	})
+}
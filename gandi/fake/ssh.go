@@ -0,0 +1,104 @@
+// Copyright 2017, Carlo Strub <cs@carlostrub.ch>
+// BSD 3-Clause License, see LICENSE file for details.
+
+package fake
+
+import (
+	"strings"
+
+	"cost.li/bapu/gandi"
+)
+
+// sshKeyTypes lists the key types accepted by hosting.ssh.create
+var sshKeyTypes = map[string]bool{
+	"ssh-rsa":             true,
+	"ssh-dss":             true,
+	"ssh-ed25519":         true,
+	"ecdsa-sha2-nistp256": true,
+	"ecdsa-sha2-nistp384": true,
+	"ecdsa-sha2-nistp521": true,
+}
+
+// lookupSSHKey returns the SSH key with the given id. The caller must hold
+// s.mu.
+func (s *Server) lookupSSHKey(id int) (*gandi.SSHKeyReturn, *Fault) {
+	key, ok := s.keys[id]
+	if !ok {
+		return nil, faultf(FaultNotFound, "ssh key %d not found", id)
+	}
+
+	return key, nil
+}
+
+func sshList(s *Server, params []interface{}) (interface{}, *Fault) {
+	keys := []gandi.SSHKeyReturn{}
+	for _, id := range sortedIDs(s.keys) {
+		key := *s.keys[id]
+		key.Value = ""
+		keys = append(keys, key)
+	}
+
+	return keys, nil
+}
+
+func sshInfo(s *Server, params []interface{}) (interface{}, *Fault) {
+	id, f := intParam(params, 0)
+	if f != nil {
+		return nil, f
+	}
+	key, f := s.lookupSSHKey(id)
+	if f != nil {
+		return nil, f
+	}
+
+	return *key, nil
+}
+
+func sshCreate(s *Server, params []interface{}) (interface{}, *Fault) {
+	spec, f := mapParam(params, 0)
+	if f != nil {
+		return nil, f
+	}
+
+	name, _, f := stringField(spec, "name")
+	if f != nil {
+		return nil, f
+	}
+	if name == "" {
+		return nil, faultf(FaultInvalidParams, "name is required")
+	}
+	value, _, f := stringField(spec, "value")
+	if f != nil {
+		return nil, f
+	}
+	value = strings.TrimSpace(value)
+	fingerprint, err := gandi.SSHFingerprint(value)
+	if err != nil || !sshKeyTypes[strings.Fields(value)[0]] {
+		return nil, faultf(FaultInvalidParams, "value is not an OpenSSH public key")
+	}
+
+	for _, other := range s.keys {
+		switch {
+		case other.Name == name:
+			return nil, faultf(FaultConflict, "ssh key name %s is already in use", name)
+		case other.Fingerprint == fingerprint:
+			return nil, faultf(FaultConflict, "ssh key %s is already registered as %s", fingerprint, other.Name)
+		}
+	}
+
+	return s.addSSHKey(gandi.SSHKeyReturn{Name: name, Value: value}), nil
+}
+
+func sshDelete(s *Server, params []interface{}) (interface{}, *Fault) {
+	id, f := intParam(params, 0)
+	if f != nil {
+		return nil, f
+	}
+	if _, f := s.lookupSSHKey(id); f != nil {
+		return nil, f
+	}
+
+	delete(s.keys, id)
+
+	return true, nil
+}
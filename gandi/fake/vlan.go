@@ -0,0 +1,240 @@
+// Copyright 2017, Carlo Strub <cs@carlostrub.ch>
+// BSD 3-Clause License, see LICENSE file for details.
+
+package fake
+
+import (
+	"net"
+
+	"cost.li/bapu/gandi"
+)
+
+// lookupVLAN returns the private VLAN with the given id. The caller must
+// hold s.mu.
+func (s *Server) lookupVLAN(id int) (*gandi.VLANReturn, *Fault) {
+	vlan, ok := s.vlans[id]
+	if !ok {
+		return nil, faultf(FaultNotFound, "vlan %d not found", id)
+	}
+
+	return vlan, nil
+}
+
+// vlanNamed returns the private VLAN with the given name, or nil. The caller
+// must hold s.mu.
+func (s *Server) vlanNamed(name string) *gandi.VLANReturn {
+	for _, vlan := range s.vlans {
+		if vlan.Name == name {
+			return vlan
+		}
+	}
+
+	return nil
+}
+
+// withVLAN returns iface with the current state of its private VLAN. The
+// caller must hold s.mu.
+func (s *Server) withVLAN(iface gandi.IfaceReturn) gandi.IfaceReturn {
+	if vlan, ok := s.vlans[iface.VLAN.ID]; ok {
+		iface.VLAN = *vlan
+	}
+
+	return iface
+}
+
+// vlanAddressUsed reports whether ip is bound to an interface in the private
+// VLAN with the given id. The caller must hold s.mu.
+func (s *Server) vlanAddressUsed(vlanID int, ip string) bool {
+	for _, other := range s.ips {
+		if iface, ok := s.ifaces[other.IfaceID]; ok && iface.VLAN.ID == vlanID && other.IP == ip {
+			return true
+		}
+	}
+
+	return false
+}
+
+// vlanAddress checks that ip is a free host address of vlan. An empty ip
+// picks the first free one. The caller must hold s.mu.
+func (s *Server) vlanAddress(vlan *gandi.VLANReturn, ip string) (string, *Fault) {
+	_, subnet, err := net.ParseCIDR(vlan.Subnet)
+	if err != nil {
+		return "", faultf(FaultInvalidParams, "vlan %s has no valid subnet", vlan.Name)
+	}
+
+	if ip != "" {
+		addr := net.ParseIP(ip)
+		switch {
+		case addr == nil || addr.To4() == nil:
+			return "", faultf(FaultInvalidParams, "%s is not an IPv4 address", ip)
+		case !subnet.Contains(addr) || addr.Equal(subnet.IP):
+			return "", faultf(FaultInvalidParams, "%s is not a host address of %s", ip, vlan.Subnet)
+		case ip == vlan.Gateway:
+			return "", faultf(FaultConflict, "%s is the gateway of vlan %s", ip, vlan.Name)
+		case s.vlanAddressUsed(vlan.ID, addr.String()):
+			return "", faultf(FaultConflict, "%s is already used in vlan %s", ip, vlan.Name)
+		}
+		return addr.String(), nil
+	}
+
+	addr := append(net.IP(nil), subnet.IP.To4()...)
+	for {
+		for i := len(addr) - 1; i >= 0; i-- {
+			addr[i]++
+			if addr[i] != 0 {
+				break
+			}
+		}
+		if !subnet.Contains(addr) {
+			return "", faultf(FaultConflict, "vlan %s has no free address left", vlan.Name)
+		}
+		if addr.String() != vlan.Gateway && !s.vlanAddressUsed(vlan.ID, addr.String()) {
+			return addr.String(), nil
+		}
+	}
+}
+
+// validGateway checks that gateway is a host address of subnet.
+func validGateway(subnet, gateway string) *Fault {
+	_, network, err := net.ParseCIDR(subnet)
+	if err != nil || network.IP.To4() == nil {
+		return faultf(FaultInvalidParams, "subnet %s is not an IPv4 network in CIDR notation", subnet)
+	}
+	if gateway == "" {
+		return nil
+	}
+
+	addr := net.ParseIP(gateway)
+	if addr == nil || !network.Contains(addr) || addr.Equal(network.IP) {
+		return faultf(FaultInvalidParams, "gateway %s is not a host address of %s", gateway, subnet)
+	}
+
+	return nil
+}
+
+func vlanList(s *Server, params []interface{}) (interface{}, *Fault) {
+	vlans := []gandi.VLANReturn{}
+	for _, id := range sortedIDs(s.vlans) {
+		vlans = append(vlans, *s.vlans[id])
+	}
+
+	return vlans, nil
+}
+
+func vlanCreate(s *Server, params []interface{}) (interface{}, *Fault) {
+	spec, f := mapParam(params, 0)
+	if f != nil {
+		return nil, f
+	}
+
+	dcID, _, f := intField(spec, "datacenter_id")
+	if f != nil {
+		return nil, f
+	}
+	dc, f := s.lookupDatacenter(dcID)
+	if f != nil {
+		return nil, f
+	}
+	name, _, f := stringField(spec, "name")
+	if f != nil {
+		return nil, f
+	}
+	if name == "" {
+		return nil, faultf(FaultInvalidParams, "name is required")
+	}
+	if s.vlanNamed(name) != nil {
+		return nil, faultf(FaultConflict, "vlan name %s is already in use", name)
+	}
+	subnet, _, f := stringField(spec, "subnet")
+	if f != nil {
+		return nil, f
+	}
+	gateway, _, f := stringField(spec, "gateway")
+	if f != nil {
+		return nil, f
+	}
+	if f = validGateway(subnet, gateway); f != nil {
+		return nil, f
+	}
+
+	vlan := s.vlans[s.addVLAN(gandi.VLANReturn{
+		DatacenterID: dc.ID,
+		Gateway:      gateway,
+		Name:         name,
+		State:        "being_created",
+		Subnet:       subnet,
+	}).ID]
+
+	return s.newOperation(gandi.OperationReturn{Type: "vlan_create"}, func() {
+		vlan.State = "created"
+	}), nil
+}
+
+func vlanUpdate(s *Server, params []interface{}) (interface{}, *Fault) {
+	id, f := intParam(params, 0)
+	if f != nil {
+		return nil, f
+	}
+	vlan, f := s.lookupVLAN(id)
+	if f != nil {
+		return nil, f
+	}
+	update, f := mapParam(params, 1)
+	if f != nil {
+		return nil, f
+	}
+
+	name, hasName, f := stringField(update, "name")
+	if f != nil {
+		return nil, f
+	}
+	if !hasName {
+		name = vlan.Name
+	}
+	if name == "" {
+		return nil, faultf(FaultInvalidParams, "name must not be empty")
+	}
+	if other := s.vlanNamed(name); other != nil && other.ID != vlan.ID {
+		return nil, faultf(FaultConflict, "vlan name %s is already in use", name)
+	}
+	gateway, hasGateway, f := stringField(update, "gateway")
+	if f != nil {
+		return nil, f
+	}
+	if !hasGateway {
+		gateway = vlan.Gateway
+	}
+	if f = validGateway(vlan.Subnet, gateway); f != nil {
+		return nil, f
+	}
+	if gateway != vlan.Gateway && s.vlanAddressUsed(vlan.ID, gateway) {
+		return nil, faultf(FaultConflict, "%s is already used in vlan %s", gateway, vlan.Name)
+	}
+
+	return s.newOperation(gandi.OperationReturn{Type: "vlan_update"}, func() {
+		vlan.Name = name
+		vlan.Gateway = gateway
+	}), nil
+}
+
+func vlanDelete(s *Server, params []interface{}) (interface{}, *Fault) {
+	id, f := intParam(params, 0)
+	if f != nil {
+		return nil, f
+	}
+	vlan, f := s.lookupVLAN(id)
+	if f != nil {
+		return nil, f
+	}
+	for _, iface := range s.ifaces {
+		if iface.VLAN.ID == vlan.ID {
+			return nil, faultf(FaultConflict, "vlan %s still has interfaces", vlan.Name)
+		}
+	}
+
+	vlan.State = "deleting"
+
+	return s.newOperation(gandi.OperationReturn{Type: "vlan_delete"}, func() {
+		delete(s.vlans, vlan.ID)
+	}), nil
+}
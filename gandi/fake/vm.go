@@ -0,0 +1,488 @@
+// Copyright 2017, Carlo Strub <cs@carlostrub.ch>
+// BSD 3-Clause License, see LICENSE file for details.
+
+package fake
+
+import (
+	"strings"
+
+	"cost.li/bapu/gandi"
+)
+
+// vmsByID returns the virtual machines ordered by id. Deleted machines stay
+// listed, so that clients can show them as such. The caller must hold s.mu.
+func (s *Server) vmsByID() []gandi.VMReturn {
+	vms := []gandi.VMReturn{}
+	for _, id := range sortedIDs(s.vms) {
+		vms = append(vms, *s.vms[id])
+	}
+
+	return vms
+}
+
+// ifacesOf returns the network interfaces of the virtual machine with the
+// given id, including their IP addresses. The caller must hold s.mu.
+func (s *Server) ifacesOf(vmID int) []gandi.IfaceReturn {
+	ifaces := []gandi.IfaceReturn{}
+	for _, id := range sortedIDs(s.ifaces) {
+		if s.ifaces[id].VMID == vmID {
+			ifaces = append(ifaces, s.ifaceWithIPs(id))
+		}
+	}
+
+	return ifaces
+}
+
+// ifaceWithIPs returns the network interface with the given id including its
+// IP addresses. The caller must hold s.mu.
+func (s *Server) ifaceWithIPs(id int) gandi.IfaceReturn {
+	iface := s.withVLAN(*s.ifaces[id])
+
+	iface.IPs = []gandi.IPReturn{}
+	for _, ipID := range sortedIDs(s.ips) {
+		if s.ips[ipID].IfaceID == id {
+			iface.IPs = append(iface.IPs, *s.ips[ipID])
+		}
+	}
+
+	return iface
+}
+
+func vmCount(s *Server, params []interface{}) (interface{}, *Fault) {
+	return len(s.vmsByID()), nil
+}
+
+func vmList(s *Server, params []interface{}) (interface{}, *Fault) {
+	return s.vmsByID(), nil
+}
+
+func vmInfo(s *Server, params []interface{}) (interface{}, *Fault) {
+	id, f := intParam(params, 0)
+	if f != nil {
+		return nil, f
+	}
+	vm, f := s.lookupVM(id)
+	if f != nil {
+		return nil, f
+	}
+
+	info := *vm
+	info.Disks = s.disksOf(vm.ID)
+	info.Ifaces = s.ifacesOf(vm.ID)
+
+	return info, nil
+}
+
+// vmTransition returns a method which moves a virtual machine from one of
+// the states in from to state to.
+func vmTransition(typ, to string, from ...string) method {
+	return func(s *Server, params []interface{}) (interface{}, *Fault) {
+		id, f := intParam(params, 0)
+		if f != nil {
+			return nil, f
+		}
+		vm, f := s.lookupVM(id)
+		if f != nil {
+			return nil, f
+		}
+
+		allowed := false
+		for _, state := range from {
+			if vm.State == state {
+				allowed = true
+			}
+		}
+		if !allowed {
+			return nil, faultf(FaultConflict, "vm %s is %s", vm.Hostname, vm.State)
+		}
+
+		return s.newOperation(gandi.OperationReturn{Type: typ, VMID: vm.ID}, func() {
+			vm.State = to
+			vm.DateUpdated = s.now()
+		}), nil
+	}
+}
+
+var (
+	vmStart  = vmTransition("vm_start", "running", "halted")
+	vmStop   = vmTransition("vm_stop", "halted", "running", "paused")
+	vmReboot = vmTransition("vm_reboot", "running", "running")
+)
+
+func vmDelete(s *Server, params []interface{}) (interface{}, *Fault) {
+	id, f := intParam(params, 0)
+	if f != nil {
+		return nil, f
+	}
+	vm, f := s.lookupVM(id)
+	if f != nil {
+		return nil, f
+	}
+	if vm.State != "halted" {
+		return nil, faultf(FaultConflict, "vm %s is %s, stop it first", vm.Hostname, vm.State)
+	}
+
+	return s.newOperation(gandi.OperationReturn{Type: "vm_delete", VMID: vm.ID}, func() {
+		vm.State = "deleted"
+		vm.DateUpdated = s.now()
+
+		// The boot disk goes with the machine, the other disks are
+		// detached
+		for _, diskID := range s.attached[vm.ID] {
+			if disk := s.disks[diskID]; disk.IsBootDisk {
+				disk.State = "deleted"
+				disk.DateUpdated = s.now()
+			}
+		}
+		delete(s.attached, vm.ID)
+
+		for ifaceID, iface := range s.ifaces {
+			if iface.VMID != vm.ID {
+				continue
+			}
+			for ipID, ip := range s.ips {
+				if ip.IfaceID == ifaceID {
+					delete(s.ips, ipID)
+				}
+			}
+			delete(s.ifaces, ifaceID)
+		}
+	}), nil
+}
+
+// consoleHost is where the emergency consoles of the fake are reached.
+const consoleHost = "console.gandi.net"
+
+func vmUpdate(s *Server, params []interface{}) (interface{}, *Fault) {
+	id, f := intParam(params, 0)
+	if f != nil {
+		return nil, f
+	}
+	vm, f := s.lookupVM(id)
+	if f != nil {
+		return nil, f
+	}
+	update, f := mapParam(params, 1)
+	if f != nil {
+		return nil, f
+	}
+
+	cores, hasCores, f := intField(update, "cores")
+	if f != nil {
+		return nil, f
+	}
+	if !hasCores {
+		cores = vm.Cores
+	}
+	memory, hasMemory, f := intField(update, "memory")
+	if f != nil {
+		return nil, f
+	}
+	if !hasMemory {
+		memory = vm.Memory
+	}
+	maxMemory, hasMaxMemory, f := intField(update, "vm_max_memory")
+	if f != nil {
+		return nil, f
+	}
+	if !hasMaxMemory {
+		maxMemory = vm.VMmaxMemory
+	}
+	console, hasConsole, f := intField(update, "console")
+	if f != nil {
+		return nil, f
+	}
+	if !hasConsole {
+		console = vm.Console
+	}
+
+	switch {
+	case cores < 1:
+		return nil, faultf(FaultInvalidParams, "at least 1 core is required")
+	case memory < 256:
+		return nil, faultf(FaultInvalidParams, "at least 256MB memory are required")
+	case memory > maxMemory:
+		return nil, faultf(FaultInvalidParams, "memory exceeds vm_max_memory of %dMB", maxMemory)
+	case console != 0 && console != 1:
+		return nil, faultf(FaultInvalidParams, "console must be 0 or 1")
+	}
+
+	// Cores and memory can be added to a running machine up to
+	// vm_max_memory, everything else requires it to be halted
+	if vm.State != "halted" && (cores < vm.Cores || memory < vm.Memory || maxMemory != vm.VMmaxMemory) {
+		return nil, faultf(FaultConflict, "vm %s is %s, stop it to shrink it or change vm_max_memory", vm.Hostname, vm.State)
+	}
+	if vm.State != "halted" && vm.State != "running" {
+		return nil, faultf(FaultConflict, "vm %s is %s", vm.Hostname, vm.State)
+	}
+
+	return s.newOperation(gandi.OperationReturn{Type: "vm_update", VMID: vm.ID}, func() {
+		vm.Cores = cores
+		vm.Memory = memory
+		vm.VMmaxMemory = maxMemory
+		vm.Console = console
+		vm.ConsoleURL = ""
+		if console == 1 {
+			vm.ConsoleURL = consoleHost
+		}
+		vm.DateUpdated = s.now()
+	}), nil
+}
+
+// migrationBlockers returns the reasons why vm cannot be migrated to dc.
+// The caller must hold s.mu.
+func (s *Server) migrationBlockers(vm *gandi.VMReturn, dc gandi.DatacenterReturn) []string {
+	blockers := []string{}
+	if vm.DatacenterID == dc.ID {
+		blockers = append(blockers, "vm "+vm.Hostname+" is in "+dc.Name+" already")
+	}
+	if vm.State != "running" && vm.State != "halted" {
+		blockers = append(blockers, "vm "+vm.Hostname+" is "+vm.State)
+	}
+	for _, op := range s.ops {
+		if op.VMID == vm.ID && !op.Finished() {
+			blockers = append(blockers, "operation "+op.Type+" on vm "+vm.Hostname+" is pending")
+		}
+	}
+
+	return blockers
+}
+
+func vmCanMigrate(s *Server, params []interface{}) (interface{}, *Fault) {
+	id, f := intParam(params, 0)
+	if f != nil {
+		return nil, f
+	}
+	vm, f := s.lookupVM(id)
+	if f != nil {
+		return nil, f
+	}
+	dcID, f := intParam(params, 1)
+	if f != nil {
+		return nil, f
+	}
+	dc, f := s.lookupDatacenter(dcID)
+	if f != nil {
+		return nil, f
+	}
+
+	blockers := s.migrationBlockers(vm, dc)
+
+	return gandi.VMCanMigrateReturn{
+		CanMigrate: len(blockers) == 0,
+		Matched:    blockers,
+	}, nil
+}
+
+// vmMigrate copies the disks of a virtual machine to another datacenter
+// and, once that is done, moves the machine there when called again with
+// finalize set.
+func vmMigrate(s *Server, params []interface{}) (interface{}, *Fault) {
+	id, f := intParam(params, 0)
+	if f != nil {
+		return nil, f
+	}
+	vm, f := s.lookupVM(id)
+	if f != nil {
+		return nil, f
+	}
+	dcID, f := intParam(params, 1)
+	if f != nil {
+		return nil, f
+	}
+	dc, f := s.lookupDatacenter(dcID)
+	if f != nil {
+		return nil, f
+	}
+	finalize, f := boolParam(params, 2)
+	if f != nil {
+		return nil, f
+	}
+
+	if blockers := s.migrationBlockers(vm, dc); len(blockers) > 0 {
+		return nil, faultf(FaultConflict, "%s", strings.Join(blockers, ", "))
+	}
+
+	if !finalize {
+		return s.newOperation(gandi.OperationReturn{Type: "vm_migrate", VMID: vm.ID}, func() {
+			s.migrations[vm.ID] = dc.ID
+		}), nil
+	}
+
+	if s.migrations[vm.ID] != dc.ID {
+		return nil, faultf(FaultConflict, "disks of vm %s have not been copied to %s yet", vm.Hostname, dc.Name)
+	}
+
+	return s.newOperation(gandi.OperationReturn{Type: "vm_migrate", VMID: vm.ID}, func() {
+		delete(s.migrations, vm.ID)
+
+		vm.DatacenterID = dc.ID
+		vm.DateUpdated = s.now()
+		for _, diskID := range s.attached[vm.ID] {
+			s.disks[diskID].DatacenterID = dc.ID
+		}
+		for _, iface := range s.ifaces {
+			if iface.VMID != vm.ID {
+				continue
+			}
+			iface.DatacenterID = dc.ID
+			for _, ip := range s.ips {
+				if ip.IfaceID == iface.ID {
+					ip.DatacenterID = dc.ID
+				}
+			}
+		}
+	}), nil
+}
+
+func vmCreateFrom(s *Server, params []interface{}) (interface{}, *Fault) {
+	vmSpec, f := mapParam(params, 0)
+	if f != nil {
+		return nil, f
+	}
+	diskSpec, f := mapParam(params, 1)
+	if f != nil {
+		return nil, f
+	}
+	srcDiskID, f := intParam(params, 2)
+	if f != nil {
+		return nil, f
+	}
+
+	dcID, _, f := intField(vmSpec, "datacenter_id")
+	if f != nil {
+		return nil, f
+	}
+	dc, f := s.lookupDatacenter(dcID)
+	if f != nil {
+		return nil, f
+	}
+
+	hostname, _, f := stringField(vmSpec, "hostname")
+	if f != nil {
+		return nil, f
+	}
+	if hostname == "" {
+		return nil, faultf(FaultInvalidParams, "hostname is required")
+	}
+	for _, vm := range s.vms {
+		if vm.Hostname == hostname && vm.State != "deleted" {
+			return nil, faultf(FaultConflict, "hostname %s is already in use", hostname)
+		}
+	}
+
+	cores, _, f := intField(vmSpec, "cores")
+	if f != nil {
+		return nil, f
+	}
+	if cores < 1 {
+		return nil, faultf(FaultInvalidParams, "at least 1 core is required")
+	}
+	memory, _, f := intField(vmSpec, "memory")
+	if f != nil {
+		return nil, f
+	}
+	if memory < 256 {
+		return nil, faultf(FaultInvalidParams, "at least 256MB memory are required")
+	}
+	ipVersion, hasIPVersion, f := intField(vmSpec, "ip_version")
+	if f != nil {
+		return nil, f
+	}
+	if !hasIPVersion {
+		ipVersion = 4
+	}
+	if ipVersion != 4 && ipVersion != 6 {
+		return nil, faultf(FaultInvalidParams, "ip_version must be 4 or 6")
+	}
+
+	_, hasSSHKey := vmSpec["ssh_key"]
+	keys, hasKeys := vmSpec["keys"]
+	if hasKeys {
+		ids, ok := keys.([]interface{})
+		if !ok {
+			return nil, faultf(FaultInvalidParams, "keys must be an array of ids")
+		}
+		for _, id := range ids {
+			id, ok := id.(int)
+			if !ok {
+				return nil, faultf(FaultInvalidParams, "keys must be an array of ids")
+			}
+			if _, f := s.lookupSSHKey(id); f != nil {
+				return nil, f
+			}
+		}
+	}
+	_, hasPassword := vmSpec["password"]
+	if !hasSSHKey && !hasKeys && !hasPassword {
+		return nil, faultf(FaultInvalidParams, "one of ssh_key, keys or password is required")
+	}
+
+	// The source is an image or a disk of the account
+	srcSize := 0
+	srcKernel := ""
+	srcLabel := ""
+	for _, image := range s.images {
+		if image.DiskID == srcDiskID && image.DatacenterID == dc.ID {
+			srcSize, srcKernel, srcLabel = image.Size, image.KernelVersion, image.Label
+		}
+	}
+	if src, ok := s.disks[srcDiskID]; ok && src.State != "deleted" {
+		if src.DatacenterID != dc.ID {
+			return nil, faultf(FaultConflict, "disk %d is not in datacenter %s", srcDiskID, dc.Name)
+		}
+		srcSize, srcKernel, srcLabel = src.Size, src.KernelVersion, src.Label
+	}
+	if srcSize == 0 {
+		return nil, faultf(FaultNotFound, "source disk %d not found in datacenter %s", srcDiskID, dc.Name)
+	}
+
+	diskName, _, f := stringField(diskSpec, "name")
+	if f != nil {
+		return nil, f
+	}
+	if diskName == "" {
+		diskName = "sys_" + hostname
+	}
+	diskSize, _, f := intField(diskSpec, "size")
+	if f != nil {
+		return nil, f
+	}
+	if diskSize < srcSize {
+		return nil, faultf(FaultInvalidParams, "disk size must be at least %dMB", srcSize)
+	}
+
+	vm := s.vms[s.addVM(gandi.VMReturn{
+		Hostname:     hostname,
+		DatacenterID: dc.ID,
+		Cores:        cores,
+		Memory:       memory,
+		State:        "being_created",
+	}).ID]
+	disk := s.disks[s.addDisk(vm.ID, gandi.DiskReturn{
+		Name:          diskName,
+		Size:          diskSize,
+		KernelVersion: srcKernel,
+		Label:         srcLabel,
+		State:         "being_created",
+	}).ID]
+	iface := s.ifaces[s.addIface(vm.ID, gandi.IfaceReturn{Bandwidth: 102400}).ID]
+	if ipVersion == 4 {
+		s.addIP(iface.ID, gandi.IPReturn{IP: s.newAddress(4), Version: 4})
+	}
+	s.addIP(iface.ID, gandi.IPReturn{IP: s.newAddress(6), Version: 6})
+
+	return []gandi.OperationReturn{
+		s.newOperation(gandi.OperationReturn{Type: "disk_create", DiskID: disk.ID}, func() {
+			disk.State = "created"
+			disk.DateUpdated = s.now()
+		}),
+		s.newOperation(gandi.OperationReturn{Type: "iface_create", IfaceID: iface.ID}, func() {
+			iface.DateUpdated = s.now()
+		}),
+		s.newOperation(gandi.OperationReturn{Type: "vm_create", VMID: vm.ID}, func() {
+			vm.State = "running"
+			vm.DateUpdated = s.now()
+		}),
+	}, nil
+}
@@ -0,0 +1,164 @@
+// Copyright 2017, Carlo Strub <cs@carlostrub.ch>
+// BSD 3-Clause License, see LICENSE file for details.
+
+package fake_test
+
+import (
+	"testing"
+	"time"
+
+	"cost.li/bapu/gandi"
+	"cost.li/bapu/gandi/fake"
+)
+
+// debianParis is the disk of the Debian image the fake offers in Equinix
+// Paris.
+const debianParis = 101
+
+// vmSpec describes a small virtual machine in Equinix Paris.
+func vmSpec(hostname string) gandi.VMCreateSpec {
+	return gandi.VMCreateSpec{
+		DatacenterID: 1,
+		Hostname:     hostname,
+		Cores:        1,
+		Memory:       512,
+		IPVersion:    4,
+		SSHKey:       "ssh-ed25519 AAAA test",
+		DiskSize:     3072,
+	}
+}
+
+// createVM creates a virtual machine in Equinix Paris from the Debian image
+// and waits until it runs.
+func (f *fixture) createVM(hostname string) gandi.VMReturn {
+	ops, err := f.client.VMCreateFrom(vmSpec(hostname), debianParis)
+	if err != nil {
+		f.t.Fatal(err)
+	}
+	if len(ops) != 3 {
+		f.t.Fatalf("got %d operations, want disk, iface and vm creation", len(ops))
+	}
+
+	var id int
+	for _, op := range ops {
+		op = f.wait(op)
+		if op.Type == "vm_create" {
+			id = op.VMID
+		}
+	}
+	if id == 0 {
+		f.t.Fatal("no vm_create operation")
+	}
+
+	vm, err := f.client.VMInfo(id)
+	if err != nil {
+		f.t.Fatal(err)
+	}
+
+	return vm
+}
+
+func TestVMCreate(t *testing.T) {
+	withFake(t, func(f *fixture) {
+		vm := f.createVM("web1")
+		if vm.State != "running" || vm.Cores != 1 || vm.Memory != 512 || vm.DatacenterID != 1 {
+			t.Fatalf("created %+v", vm)
+		}
+		if len(vm.Disks) != 1 || !vm.Disks[0].IsBootDisk || vm.Disks[0].Size != 3072 {
+			t.Fatalf("created with disks %+v", vm.Disks)
+		}
+		if len(vm.Ifaces) != 1 || len(vm.Ifaces[0].IPs) != 2 {
+			t.Fatalf("created with ifaces %+v", vm.Ifaces)
+		}
+
+		_, err := f.client.VMCreateFrom(vmSpec("web1"), debianParis)
+		wantFault(t, err, fake.FaultConflict)
+
+		spec := vmSpec("tiny")
+		spec.Memory = 128
+		_, err = f.client.VMCreateFrom(spec, debianParis)
+		wantFault(t, err, fake.FaultInvalidParams)
+
+		_, err = f.client.VMCreateFrom(vmSpec("imageless"), 999)
+		wantFault(t, err, fake.FaultNotFound)
+	})
+}
+
+func TestVMCreateWaits(t *testing.T) {
+	withFake(t, func(f *fixture) {
+		f.srv.Delay = time.Minute
+
+		ops, err := f.client.VMCreateFrom(vmSpec("pending"), debianParis)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		vms, err := f.client.VMList()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(vms) != 1 || vms[0].State != "being_created" {
+			t.Fatalf("listed %+v while creating", vms)
+		}
+
+		for _, op := range ops {
+			f.wait(op)
+		}
+		vms, err = f.client.VMList()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if vms[0].State != "running" {
+			t.Fatalf("vm is %s once created", vms[0].State)
+		}
+	})
+}
+
+func TestVMDelete(t *testing.T) {
+	withFake(t, func(f *fixture) {
+		vm := f.createVM("web1")
+
+		// Running machines cannot be deleted
+		_, err := f.client.VMDelete(vm.ID)
+		wantFault(t, err, fake.FaultConflict)
+
+		op, err := f.client.VMStop(vm.ID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		f.wait(op)
+		op, err = f.client.VMDelete(vm.ID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		f.wait(op)
+
+		_, err = f.client.VMInfo(vm.ID)
+		wantFault(t, err, fake.FaultNotFound)
+		vms, err := f.client.VMList()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(vms) != 1 || vms[0].State != "deleted" {
+			t.Fatalf("listed %+v once deleted", vms)
+		}
+
+		// The boot disk and the interfaces go with the machine
+		disks, err := f.client.DiskList()
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, disk := range disks {
+			if disk.State != "deleted" {
+				t.Fatalf("boot disk %s is %s once its vm is deleted", disk.Name, disk.State)
+			}
+		}
+		ifaces, err := f.client.IfaceList()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(ifaces) != 0 {
+			t.Fatalf("ifaces %+v left once their vm is deleted", ifaces)
+		}
+	})
+}
@@ -0,0 +1,329 @@
+// Copyright 2017, Carlo Strub <cs@carlostrub.ch>
+// BSD 3-Clause License, see LICENSE file for details.
+
+package fake
+
+import (
+	"bytes"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// iso8601 is the date format used by XML-RPC.
+const iso8601 = "20060102T15:04:05"
+
+var errInvalidXML = errors.New("invalid xml-rpc request")
+
+// decodeCall parses an XML-RPC method call. Parameters are decoded into int,
+// float64, bool, string, time.Time, []interface{} and
+// map[string]interface{} values.
+func decodeCall(r io.Reader) (method string, params []interface{}, err error) {
+	dec := xml.NewDecoder(r)
+
+	for {
+		tok, err := dec.Token()
+		if err == io.EOF {
+			return method, params, nil
+		}
+		if err != nil {
+			return "", nil, err
+		}
+
+		start, ok := tok.(xml.StartElement)
+		if !ok {
+			continue
+		}
+
+		switch start.Name.Local {
+		case "methodName":
+			var name string
+			err = dec.DecodeElement(&name, &start)
+			if err != nil {
+				return "", nil, err
+			}
+			method = strings.TrimSpace(name)
+		case "value":
+			v, err := decodeValue(dec)
+			if err != nil {
+				return "", nil, err
+			}
+			params = append(params, v)
+		}
+	}
+}
+
+// decodeValue decodes the content of a <value> element whose start tag has
+// already been consumed, including its end tag.
+func decodeValue(dec *xml.Decoder) (interface{}, error) {
+	var text string
+
+	for {
+		tok, err := dec.Token()
+		if err != nil {
+			return nil, err
+		}
+
+		switch t := tok.(type) {
+		case xml.CharData:
+			text += string(t)
+		case xml.EndElement:
+			// A value without type is a string
+			return text, nil
+		case xml.StartElement:
+			v, err := decodeTyped(dec, t)
+			if err != nil {
+				return nil, err
+			}
+
+			// Consume up to </value>
+			err = dec.Skip()
+			if err != nil {
+				return nil, err
+			}
+
+			return v, nil
+		}
+	}
+}
+
+// decodeTyped decodes the typed element start, e.g. <int> or <struct>.
+func decodeTyped(dec *xml.Decoder, start xml.StartElement) (interface{}, error) {
+	switch start.Name.Local {
+	case "struct":
+		return decodeStruct(dec)
+	case "array":
+		return decodeArray(dec)
+	case "nil":
+		return nil, dec.Skip()
+	}
+
+	var data string
+	err := dec.DecodeElement(&data, &start)
+	if err != nil {
+		return nil, err
+	}
+
+	switch start.Name.Local {
+	case "int", "i4", "i8":
+		return strconv.Atoi(strings.TrimSpace(data))
+	case "double":
+		return strconv.ParseFloat(strings.TrimSpace(data), 64)
+	case "boolean":
+		return strconv.ParseBool(strings.TrimSpace(data))
+	case "string", "base64":
+		return data, nil
+	case "dateTime.iso8601":
+		return time.Parse(iso8601, strings.TrimSpace(data))
+	}
+
+	return nil, fmt.Errorf("unsupported xml-rpc type %s", start.Name.Local)
+}
+
+func decodeStruct(dec *xml.Decoder) (interface{}, error) {
+	m := make(map[string]interface{})
+
+	for {
+		tok, err := dec.Token()
+		if err != nil {
+			return nil, err
+		}
+
+		switch t := tok.(type) {
+		case xml.EndElement:
+			return m, nil
+		case xml.StartElement:
+			if t.Name.Local != "member" {
+				return nil, errInvalidXML
+			}
+
+			name, v, err := decodeMember(dec)
+			if err != nil {
+				return nil, err
+			}
+			m[name] = v
+		}
+	}
+}
+
+func decodeMember(dec *xml.Decoder) (name string, v interface{}, err error) {
+	for {
+		tok, err := dec.Token()
+		if err != nil {
+			return "", nil, err
+		}
+
+		switch t := tok.(type) {
+		case xml.EndElement:
+			return name, v, nil
+		case xml.StartElement:
+			switch t.Name.Local {
+			case "name":
+				err = dec.DecodeElement(&name, &t)
+				name = strings.TrimSpace(name)
+			case "value":
+				v, err = decodeValue(dec)
+			default:
+				err = errInvalidXML
+			}
+			if err != nil {
+				return "", nil, err
+			}
+		}
+	}
+}
+
+func decodeArray(dec *xml.Decoder) (interface{}, error) {
+	a := []interface{}{}
+
+	for {
+		tok, err := dec.Token()
+		if err != nil {
+			return nil, err
+		}
+
+		switch t := tok.(type) {
+		case xml.EndElement:
+			if t.Name.Local == "array" {
+				return a, nil
+			}
+		case xml.StartElement:
+			switch t.Name.Local {
+			case "data":
+			case "value":
+				v, err := decodeValue(dec)
+				if err != nil {
+					return nil, err
+				}
+				a = append(a, v)
+			default:
+				return nil, errInvalidXML
+			}
+		}
+	}
+}
+
+// encodeResponse writes an XML-RPC method response carrying v.
+func encodeResponse(w io.Writer, v interface{}) error {
+	var b bytes.Buffer
+
+	b.WriteString(`<?xml version="1.0" encoding="UTF-8"?>`)
+	b.WriteString("<methodResponse><params><param>")
+	err := encodeValue(&b, reflect.ValueOf(v))
+	if err != nil {
+		return err
+	}
+	b.WriteString("</param></params></methodResponse>")
+
+	_, err = w.Write(b.Bytes())
+	return err
+}
+
+// encodeFault writes an XML-RPC fault response.
+func encodeFault(w io.Writer, f *Fault) error {
+	var b bytes.Buffer
+
+	b.WriteString(`<?xml version="1.0" encoding="UTF-8"?>`)
+	b.WriteString("<methodResponse><fault>")
+	err := encodeValue(&b, reflect.ValueOf(map[string]interface{}{
+		"faultCode":   f.Code,
+		"faultString": f.Message,
+	}))
+	if err != nil {
+		return err
+	}
+	b.WriteString("</fault></methodResponse>")
+
+	_, err = w.Write(b.Bytes())
+	return err
+}
+
+// encodeValue writes val as XML-RPC <value>. Struct fields are named after
+// their xmlrpc tag, the same way the client decodes them.
+func encodeValue(b *bytes.Buffer, val reflect.Value) error {
+	for val.Kind() == reflect.Ptr || val.Kind() == reflect.Interface {
+		if val.IsNil() {
+			b.WriteString("<value><nil/></value>")
+			return nil
+		}
+		val = val.Elem()
+	}
+
+	b.WriteString("<value>")
+
+	switch val.Kind() {
+	case reflect.Struct:
+		if t, ok := val.Interface().(time.Time); ok {
+			b.WriteString("<dateTime.iso8601>" + t.Format(iso8601) + "</dateTime.iso8601>")
+			break
+		}
+
+		b.WriteString("<struct>")
+		typ := val.Type()
+		for i := 0; i < typ.NumField(); i++ {
+			f := typ.Field(i)
+			if f.PkgPath != "" {
+				continue
+			}
+
+			name := f.Tag.Get("xmlrpc")
+			if name == "" {
+				name = f.Name
+			}
+
+			b.WriteString("<member><name>" + name + "</name>")
+			err := encodeValue(b, val.Field(i))
+			if err != nil {
+				return err
+			}
+			b.WriteString("</member>")
+		}
+		b.WriteString("</struct>")
+	case reflect.Map:
+		b.WriteString("<struct>")
+		for _, k := range val.MapKeys() {
+			b.WriteString("<member><name>")
+			xml.EscapeText(b, []byte(k.String()))
+			b.WriteString("</name>")
+			err := encodeValue(b, val.MapIndex(k))
+			if err != nil {
+				return err
+			}
+			b.WriteString("</member>")
+		}
+		b.WriteString("</struct>")
+	case reflect.Slice, reflect.Array:
+		b.WriteString("<array><data>")
+		for i := 0; i < val.Len(); i++ {
+			err := encodeValue(b, val.Index(i))
+			if err != nil {
+				return err
+			}
+		}
+		b.WriteString("</data></array>")
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		b.WriteString("<int>" + strconv.FormatInt(val.Int(), 10) + "</int>")
+	case reflect.Float32, reflect.Float64:
+		b.WriteString("<double>" + strconv.FormatFloat(val.Float(), 'f', -1, 64) + "</double>")
+	case reflect.Bool:
+		if val.Bool() {
+			b.WriteString("<boolean>1</boolean>")
+		} else {
+			b.WriteString("<boolean>0</boolean>")
+		}
+	case reflect.String:
+		b.WriteString("<string>")
+		xml.EscapeText(b, []byte(val.String()))
+		b.WriteString("</string>")
+	default:
+		return fmt.Errorf("cannot encode %s as xml-rpc", val.Kind())
+	}
+
+	b.WriteString("</value>")
+	return nil
+}
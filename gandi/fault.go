@@ -0,0 +1,50 @@
+// Copyright 2017, Carlo Strub <cs@carlostrub.ch>
+// BSD 3-Clause License, see LICENSE file for details.
+
+package gandi
+
+import (
+	"fmt"
+	"net/rpc"
+	"regexp"
+	"strconv"
+)
+
+// faultRx matches the way the xmlrpc package flattens a fault response into
+// an rpc.ServerError.
+var faultRx = regexp.MustCompile(`(?s)^error: "(.*)" code: (-?\d+)$`)
+
+// Fault is an XML-RPC fault returned by the Gandi API.
+type Fault struct {
+	Code    int
+	Message string
+}
+
+// Error implements the error interface.
+func (f *Fault) Error() string {
+	return fmt.Sprintf("%s (fault %d)", f.Message, f.Code)
+}
+
+// toFault converts the error of an XML-RPC call into a *Fault if the server
+// answered with a fault. Any other error is returned unchanged.
+func toFault(err error) error {
+	serverErr, ok := err.(rpc.ServerError)
+	if !ok {
+		return err
+	}
+
+	m := faultRx.FindStringSubmatch(string(serverErr))
+	if m == nil {
+		return err
+	}
+
+	code, err := strconv.Atoi(m[2])
+	if err != nil {
+		return serverErr
+	}
+
+	return &Fault{
+		Code:    code,
+		Message: m[1],
+	}
+}
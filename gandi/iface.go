@@ -0,0 +1,71 @@
+// Copyright 2017, Carlo Strub <cs@carlostrub.ch>
+// BSD 3-Clause License, see LICENSE file for details.
+
+package gandi
+
+import (
+	"time"
+)
+
+// IfaceReturn contains fields for informations about the network interfaces
+type IfaceReturn struct {
+	Bandwidth    float64    `xmlrpc:"bandwidth"`
+	DatacenterID int        `xmlrpc:"datacenter_id"`
+	DateCreated  time.Time  `xmlrpc:"date_created"`
+	DateUpdated  time.Time  `xmlrpc:"date_updated"`
+	ID           int        `xmlrpc:"id"`
+	IPs          []IPReturn `xmlrpc:"ips"`
+	Num          int        `xmlrpc:"num"`
+	State        string     `xmlrpc:"state"`
+	Type         string     `xmlrpc:"type"`
+	VLAN         VLANReturn `xmlrpc:"vlan"`
+	VMID         int        `xmlrpc:"vm_id"`
+}
+
+// IfaceList returns all network interfaces of the account. The IP addresses
+// of an interface are only included by IPList.
+func (c *Client) IfaceList() (ifaces []IfaceReturn, err error) {
+	err = c.call("hosting.iface.list", &ifaces, map[string]interface{}{})
+
+	return ifaces, err
+}
+
+// IfaceCreateSpec describes a network interface to create with IfaceCreate.
+type IfaceCreateSpec struct {
+	DatacenterID int
+	Bandwidth    float64 // kbit/s, 0 for the default
+	IPVersion    int     // 4 or 6, ignored for private interfaces
+	VLAN         int     // id of the private VLAN, 0 for a public interface
+	IP           string  // address in the VLAN, empty for any free one
+}
+
+// IfaceCreate creates a network interface with an IP address according to
+// spec. It is not attached to any virtual machine.
+func (c *Client) IfaceCreate(spec IfaceCreateSpec) (op OperationReturn, err error) {
+	params := map[string]interface{}{
+		"datacenter_id": spec.DatacenterID,
+	}
+	if spec.VLAN != 0 {
+		params["vlan"] = spec.VLAN
+	} else {
+		params["ip_version"] = spec.IPVersion
+	}
+	if spec.IP != "" {
+		params["ip"] = spec.IP
+	}
+	if spec.Bandwidth != 0 {
+		params["bandwidth"] = spec.Bandwidth
+	}
+
+	err = c.call("hosting.iface.create", &op, params)
+
+	return op, err
+}
+
+// IfaceDelete deletes the network interface with the given id, releasing
+// its IP addresses. The interface must not be attached.
+func (c *Client) IfaceDelete(id int) (op OperationReturn, err error) {
+	err = c.call("hosting.iface.delete", &op, id)
+
+	return op, err
+}
@@ -0,0 +1,34 @@
+// Copyright 2017, Carlo Strub <cs@carlostrub.ch>
+// BSD 3-Clause License, see LICENSE file for details.
+
+package gandi
+
+import (
+	"time"
+)
+
+// ImageReturn contains fields for informations about the operating system
+// images virtual machines can be created from
+type ImageReturn struct {
+	AuthorID      int       `xmlrpc:"author_id"`
+	DatacenterID  int       `xmlrpc:"datacenter_id"`
+	DateCreated   time.Time `xmlrpc:"date_created"`
+	DateUpdated   time.Time `xmlrpc:"date_updated"`
+	DiskID        int       `xmlrpc:"disk_id"`
+	ID            int       `xmlrpc:"id"`
+	KernelVersion string    `xmlrpc:"kernel_version"`
+	Label         string    `xmlrpc:"label"`
+	OSArch        string    `xmlrpc:"os_arch"`
+	Size          int       `xmlrpc:"size"`
+	Visibility    string    `xmlrpc:"visibility"`
+}
+
+// ImageList returns the images available in the datacenter with the given
+// id.
+func (c *Client) ImageList(datacenterID int) (images []ImageReturn, err error) {
+	err = c.call("hosting.image.list", &images, map[string]interface{}{
+		"datacenter_id": datacenterID,
+	})
+
+	return images, err
+}
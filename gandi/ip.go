@@ -0,0 +1,44 @@
+// Copyright 2017, Carlo Strub <cs@carlostrub.ch>
+// BSD 3-Clause License, see LICENSE file for details.
+
+package gandi
+
+import (
+	"time"
+)
+
+// IPReturn contains fields for informations about the IP addresses
+type IPReturn struct {
+	DatacenterID int       `xmlrpc:"datacenter_id"`
+	DateCreated  time.Time `xmlrpc:"date_created"`
+	DateUpdated  time.Time `xmlrpc:"date_updated"`
+	ID           int       `xmlrpc:"id"`
+	IfaceID      int       `xmlrpc:"iface_id"`
+	IP           string    `xmlrpc:"ip"`
+	Num          int       `xmlrpc:"num"`
+	Reverse      string    `xmlrpc:"reverse"`
+	State        string    `xmlrpc:"state"`
+	Version      int       `xmlrpc:"version"`
+}
+
+// IPList returns all IP addresses of the account.
+func (c *Client) IPList() (ips []IPReturn, err error) {
+	err = c.call("hosting.ip.list", &ips, map[string]interface{}{})
+
+	return ips, err
+}
+
+// IPUpdateSpec holds the properties of an IP address to change with
+// IPUpdate.
+type IPUpdateSpec struct {
+	Reverse string // hostname of the PTR record
+}
+
+// IPUpdate changes the IP address with the given id according to spec.
+func (c *Client) IPUpdate(id int, spec IPUpdateSpec) (op OperationReturn, err error) {
+	err = c.call("hosting.ip.update", &op, id, map[string]interface{}{
+		"reverse": spec.Reverse,
+	})
+
+	return op, err
+}
@@ -0,0 +1,53 @@
+// Copyright 2017, Carlo Strub <cs@carlostrub.ch>
+// BSD 3-Clause License, see LICENSE file for details.
+
+package gandi
+
+import (
+	"time"
+)
+
+// Steps an operation passes through
+const (
+	StepBill    = "BILL"
+	StepWait    = "WAIT"
+	StepRun     = "RUN"
+	StepDone    = "DONE"
+	StepError   = "ERROR"
+	StepSupport = "SUPPORT"
+	StepCancel  = "CANCEL"
+)
+
+// OperationReturn contains fields for informations about an asynchronous
+// operation, such as starting a virtual machine
+type OperationReturn struct {
+	DateCreated time.Time `xmlrpc:"date_created"`
+	DateStart   time.Time `xmlrpc:"date_start"`
+	DateUpdated time.Time `xmlrpc:"date_updated"`
+	DiskID      int       `xmlrpc:"disk_id"`
+	ID          int       `xmlrpc:"id"`
+	IfaceID     int       `xmlrpc:"iface_id"`
+	IPID        int       `xmlrpc:"ip_id"`
+	LastError   string    `xmlrpc:"last_error"`
+	Source      string    `xmlrpc:"source"`
+	Step        string    `xmlrpc:"step"`
+	Type        string    `xmlrpc:"type"`
+	VMID        int       `xmlrpc:"vm_id"`
+}
+
+// Finished reports whether the operation reached a final step.
+func (o OperationReturn) Finished() bool {
+	switch o.Step {
+	case StepDone, StepError, StepCancel:
+		return true
+	}
+
+	return false
+}
+
+// OperationInfo returns the current state of the operation with the given id.
+func (c *Client) OperationInfo(id int) (op OperationReturn, err error) {
+	err = c.call("operation.info", &op, id)
+
+	return op, err
+}
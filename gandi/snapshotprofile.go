@@ -0,0 +1,28 @@
+// Copyright 2017, Carlo Strub <cs@carlostrub.ch>
+// BSD 3-Clause License, see LICENSE file for details.
+
+package gandi
+
+// SnapshotProfileReturn contains fields for informations about a snapshot
+// profile, the policy by which snapshots of a disk are taken and kept.
+type SnapshotProfileReturn struct {
+	ID          int                      `xmlrpc:"id"`
+	KeptTotal   int                      `xmlrpc:"kept_total"`
+	Name        string                   `xmlrpc:"name"`
+	QuotaFactor float64                  `xmlrpc:"quota_factor"`
+	Schedules   []SnapshotScheduleReturn `xmlrpc:"schedules"`
+}
+
+// SnapshotScheduleReturn tells how many snapshots taken at an interval of a
+// snapshot profile are kept.
+type SnapshotScheduleReturn struct {
+	KeptVersion int    `xmlrpc:"kept_version"`
+	Name        string `xmlrpc:"name"` // hourly, daily, weekly or monthly
+}
+
+// SnapshotProfileList returns all snapshot profiles.
+func (c *Client) SnapshotProfileList() (profiles []SnapshotProfileReturn, err error) {
+	err = c.call("hosting.snapshotprofile.list", &profiles, map[string]interface{}{})
+
+	return profiles, err
+}
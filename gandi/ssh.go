@@ -0,0 +1,76 @@
+// Copyright 2017, Carlo Strub <cs@carlostrub.ch>
+// BSD 3-Clause License, see LICENSE file for details.
+
+package gandi
+
+import (
+	"crypto/md5"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// SSHKeyReturn contains fields for informations about the SSH keys registered
+// on the account
+type SSHKeyReturn struct {
+	Fingerprint string `xmlrpc:"fingerprint"`
+	ID          int    `xmlrpc:"id"`
+	Name        string `xmlrpc:"name"`
+	Value       string `xmlrpc:"value"` // only returned by SSHKeyInfo and SSHKeyCreate
+}
+
+// SSHKeyList returns all SSH keys of the account, without their values.
+func (c *Client) SSHKeyList() (keys []SSHKeyReturn, err error) {
+	err = c.call("hosting.ssh.list", &keys, map[string]interface{}{})
+
+	return keys, err
+}
+
+// SSHKeyInfo returns the SSH key with the given id, including its value.
+func (c *Client) SSHKeyInfo(id int) (key SSHKeyReturn, err error) {
+	err = c.call("hosting.ssh.info", &key, id)
+
+	return key, err
+}
+
+// SSHKeyCreate registers the public key value, as found in an OpenSSH .pub
+// file, under name.
+func (c *Client) SSHKeyCreate(name, value string) (key SSHKeyReturn, err error) {
+	err = c.call("hosting.ssh.create", &key, map[string]interface{}{
+		"name":  name,
+		"value": value,
+	})
+
+	return key, err
+}
+
+// SSHKeyDelete removes the SSH key with the given id from the account.
+// Virtual machines it was installed on keep it.
+func (c *Client) SSHKeyDelete(id int) error {
+	var deleted bool
+
+	return c.call("hosting.ssh.delete", &deleted, id)
+}
+
+// SSHFingerprint returns the MD5 fingerprint of the public key value, in the
+// colon separated form shown by Gandi.
+func SSHFingerprint(value string) (string, error) {
+	fields := strings.Fields(value)
+	if len(fields) < 2 {
+		return "", errors.New("not a public key")
+	}
+
+	blob, err := base64.StdEncoding.DecodeString(fields[1])
+	if err != nil {
+		return "", errors.New("not a public key")
+	}
+
+	sum := md5.Sum(blob)
+	hex := make([]string, len(sum))
+	for i, b := range sum {
+		hex[i] = fmt.Sprintf("%02x", b)
+	}
+
+	return strings.Join(hex, ":"), nil
+}
@@ -0,0 +1,76 @@
+// Copyright 2017, Carlo Strub <cs@carlostrub.ch>
+// BSD 3-Clause License, see LICENSE file for details.
+
+package gandi
+
+// VLANReturn contains fields for informations about the private VLANs
+type VLANReturn struct {
+	DatacenterID int    `xmlrpc:"datacenter_id"`
+	Gateway      string `xmlrpc:"gateway"`
+	ID           int    `xmlrpc:"id"`
+	Name         string `xmlrpc:"name"`
+	State        string `xmlrpc:"state"`
+	Subnet       string `xmlrpc:"subnet"`
+	UUID         int    `xmlrpc:"uuid"`
+}
+
+// VLANList returns all private VLANs of the account.
+func (c *Client) VLANList() (vlans []VLANReturn, err error) {
+	err = c.call("hosting.vlan.list", &vlans, map[string]interface{}{})
+
+	return vlans, err
+}
+
+// VLANCreateSpec describes a private VLAN to create with VLANCreate.
+type VLANCreateSpec struct {
+	DatacenterID int
+	Name         string
+	Subnet       string // in CIDR notation, such as 192.168.0.0/24
+	Gateway      string // optional
+}
+
+// VLANCreate creates a private VLAN according to spec.
+func (c *Client) VLANCreate(spec VLANCreateSpec) (op OperationReturn, err error) {
+	params := map[string]interface{}{
+		"datacenter_id": spec.DatacenterID,
+		"name":          spec.Name,
+		"subnet":        spec.Subnet,
+	}
+	if spec.Gateway != "" {
+		params["gateway"] = spec.Gateway
+	}
+
+	err = c.call("hosting.vlan.create", &op, params)
+
+	return op, err
+}
+
+// VLANUpdateSpec holds the properties of a private VLAN to change with
+// VLANUpdate. Empty fields are left unchanged.
+type VLANUpdateSpec struct {
+	Name    string
+	Gateway string
+}
+
+// VLANUpdate changes the private VLAN with the given id according to spec.
+func (c *Client) VLANUpdate(id int, spec VLANUpdateSpec) (op OperationReturn, err error) {
+	params := map[string]interface{}{}
+	if spec.Name != "" {
+		params["name"] = spec.Name
+	}
+	if spec.Gateway != "" {
+		params["gateway"] = spec.Gateway
+	}
+
+	err = c.call("hosting.vlan.update", &op, id, params)
+
+	return op, err
+}
+
+// VLANDelete deletes the private VLAN with the given id. It must not have
+// any interfaces.
+func (c *Client) VLANDelete(id int) (op OperationReturn, err error) {
+	err = c.call("hosting.vlan.delete", &op, id)
+
+	return op, err
+}
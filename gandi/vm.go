@@ -0,0 +1,226 @@
+// Copyright 2017, Carlo Strub <cs@carlostrub.ch>
+// BSD 3-Clause License, see LICENSE file for details.
+
+package gandi
+
+import (
+	"time"
+)
+
+// VMReturn contains fields for informations about the virtual machines
+type VMReturn struct {
+	AiActive     int           `xmlrpc:"ai_active"`
+	Console      int           `xmlrpc:"console"`
+	ConsoleURL   string        `xmlrpc:"console_url"`
+	Cores        int           `xmlrpc:"cores"`
+	DatacenterID int           `xmlrpc:"datacenter_id"`
+	DateCreated  time.Time     `xmlrpc:"date_created"`
+	DateUpdated  time.Time     `xmlrpc:"date_updated"`
+	Description  string        `xmlrpc:"description"`
+	Disks        []DiskReturn  `xmlrpc:"disks"`
+	Farm         string        `xmlrpc:"farm"`
+	FlexShares   int           `xmlrpc:"flex_shares"`
+	Hostname     string        `xmlrpc:"hostname"`
+	HVMState     string        `xmlrpc:"hvm_state"`
+	ID           int           `xmlrpc:"id"`
+	Ifaces       []IfaceReturn `xmlrpc:"ifaces"`
+	Memory       int           `xmlrpc:"memory"`
+	State        string        `xmlrpc:"state"`
+	VMmaxMemory  int           `xmlrpc:"vm_max_memory"`
+}
+
+// VMCount returns the number of virtual machines of the account.
+func (c *Client) VMCount() (count int, err error) {
+	err = c.call("hosting.vm.count", &count)
+
+	return count, err
+}
+
+// VMList returns all virtual machines of the account.
+func (c *Client) VMList() (vms []VMReturn, err error) {
+	err = c.call("hosting.vm.list", &vms)
+
+	return vms, err
+}
+
+// VMInfo returns the virtual machine with the given id, including its disks
+// and network interfaces.
+func (c *Client) VMInfo(id int) (vm VMReturn, err error) {
+	err = c.call("hosting.vm.info", &vm, id)
+
+	return vm, err
+}
+
+// VMStart starts the virtual machine with the given id.
+func (c *Client) VMStart(id int) (op OperationReturn, err error) {
+	err = c.call("hosting.vm.start", &op, id)
+
+	return op, err
+}
+
+// VMStop stops the virtual machine with the given id.
+func (c *Client) VMStop(id int) (op OperationReturn, err error) {
+	err = c.call("hosting.vm.stop", &op, id)
+
+	return op, err
+}
+
+// VMReboot reboots the virtual machine with the given id.
+func (c *Client) VMReboot(id int) (op OperationReturn, err error) {
+	err = c.call("hosting.vm.reboot", &op, id)
+
+	return op, err
+}
+
+// VMDelete deletes the halted virtual machine with the given id together
+// with its boot disk. Other disks are detached and kept.
+func (c *Client) VMDelete(id int) (op OperationReturn, err error) {
+	err = c.call("hosting.vm.delete", &op, id)
+
+	return op, err
+}
+
+// VMUpdateSpec holds the attributes of a virtual machine to change with
+// VMUpdate. Attributes left at their zero value are not changed.
+type VMUpdateSpec struct {
+	Cores       int
+	Memory      int // MB
+	VMmaxMemory int // MB, can only be changed while the machine is halted
+}
+
+// VMUpdate changes the virtual machine with the given id according to spec.
+func (c *Client) VMUpdate(id int, spec VMUpdateSpec) (op OperationReturn, err error) {
+	params := map[string]interface{}{}
+	if spec.Cores != 0 {
+		params["cores"] = spec.Cores
+	}
+	if spec.Memory != 0 {
+		params["memory"] = spec.Memory
+	}
+	if spec.VMmaxMemory != 0 {
+		params["vm_max_memory"] = spec.VMmaxMemory
+	}
+
+	err = c.call("hosting.vm.update", &op, id, params)
+
+	return op, err
+}
+
+// VMConsole enables or disables the emergency console of the virtual machine
+// with the given id. Once enabled, the console is reached via SSH to the
+// host in ConsoleURL.
+func (c *Client) VMConsole(id int, enable bool) (op OperationReturn, err error) {
+	console := 0
+	if enable {
+		console = 1
+	}
+
+	err = c.call("hosting.vm.update", &op, id, map[string]interface{}{
+		"console": console,
+	})
+
+	return op, err
+}
+
+// VMCanMigrateReturn tells whether a virtual machine can be migrated to a
+// datacenter.
+type VMCanMigrateReturn struct {
+	CanMigrate bool     `xmlrpc:"can_migrate"`
+	Matched    []string `xmlrpc:"matched"` // what prevents the migration, or warnings if it can be
+}
+
+// VMCanMigrate checks whether the virtual machine with the given id can be
+// migrated to the datacenter with id datacenterID.
+func (c *Client) VMCanMigrate(id, datacenterID int) (result VMCanMigrateReturn, err error) {
+	err = c.call("hosting.vm.can_migrate", &result, id, datacenterID)
+
+	return result, err
+}
+
+// VMMigrate migrates the virtual machine with the given id to the
+// datacenter with id datacenterID in two phases: without finalize, its disks
+// are copied while it keeps running; with finalize, the machine is moved
+// over, which takes it offline for a short time.
+func (c *Client) VMMigrate(id, datacenterID int, finalize bool) (op OperationReturn, err error) {
+	err = c.call("hosting.vm.migrate", &op, id, datacenterID, finalize)
+
+	return op, err
+}
+
+// VMDiskAttach attaches the disk with id diskID to the virtual machine with
+// id vmID at the given position. The disk at position 0 is the boot disk.
+func (c *Client) VMDiskAttach(vmID, diskID, position int) (op OperationReturn, err error) {
+	err = c.call("hosting.vm.disk_attach", &op, vmID, diskID, map[string]interface{}{
+		"position": position,
+	})
+
+	return op, err
+}
+
+// VMDiskDetach detaches the disk with id diskID from the virtual machine
+// with id vmID.
+func (c *Client) VMDiskDetach(vmID, diskID int) (op OperationReturn, err error) {
+	err = c.call("hosting.vm.disk_detach", &op, vmID, diskID)
+
+	return op, err
+}
+
+// VMIfaceAttach attaches the network interface with id ifaceID to the
+// virtual machine with id vmID.
+func (c *Client) VMIfaceAttach(vmID, ifaceID int) (op OperationReturn, err error) {
+	err = c.call("hosting.vm.iface_attach", &op, vmID, ifaceID)
+
+	return op, err
+}
+
+// VMIfaceDetach detaches the network interface with id ifaceID from the
+// virtual machine with id vmID.
+func (c *Client) VMIfaceDetach(vmID, ifaceID int) (op OperationReturn, err error) {
+	err = c.call("hosting.vm.iface_detach", &op, vmID, ifaceID)
+
+	return op, err
+}
+
+// VMCreateSpec describes a virtual machine to create with VMCreateFrom.
+type VMCreateSpec struct {
+	DatacenterID int
+	Hostname     string
+	Cores        int
+	Memory       int // MB
+	IPVersion    int // 4 for IPv4 and IPv6, 6 for IPv6 only
+	SSHKey       string
+	KeyIDs       []int // SSH keys registered with the account
+
+	DiskName string
+	DiskSize int // MB
+}
+
+// VMCreateFrom creates a virtual machine according to spec, with a system
+// disk copied from the disk with id srcDiskID, usually the disk of an image.
+// It returns the operations creating the disk, the network interface and
+// the machine.
+func (c *Client) VMCreateFrom(spec VMCreateSpec, srcDiskID int) (ops []OperationReturn, err error) {
+	vmSpec := map[string]interface{}{
+		"datacenter_id": spec.DatacenterID,
+		"hostname":      spec.Hostname,
+		"cores":         spec.Cores,
+		"memory":        spec.Memory,
+		"ip_version":    spec.IPVersion,
+	}
+	if spec.SSHKey != "" {
+		vmSpec["ssh_key"] = spec.SSHKey
+	}
+	if len(spec.KeyIDs) > 0 {
+		vmSpec["keys"] = spec.KeyIDs
+	}
+
+	diskSpec := map[string]interface{}{
+		"datacenter_id": spec.DatacenterID,
+		"name":          spec.DiskName,
+		"size":          spec.DiskSize,
+	}
+
+	err = c.call("hosting.vm.create_from", &ops, vmSpec, diskSpec, srcDiskID)
+
+	return ops, err
+}
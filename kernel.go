@@ -0,0 +1,200 @@
+// Copyright 2017, Carlo Strub <cs@carlostrub.ch>
+// BSD 3-Clause License, see LICENSE file for details.
+
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"cost.li/bapu/gandi"
+)
+
+// bootDisk returns the boot disk of the virtual machine with the given id
+// among disks.
+func bootDisk(vmID int, disks []gandi.DiskReturn) (gandi.DiskReturn, bool) {
+	for _, disk := range disks {
+		if !disk.IsBootDisk {
+			continue
+		}
+		for _, id := range disk.VMsID {
+			if id == vmID {
+				return disk, true
+			}
+		}
+	}
+
+	return gandi.DiskReturn{}, false
+}
+
+// sortedKernels flattens kernels, as returned by hosting.disk.list_kernels,
+// into a list sorted by family and version, along with the family of each.
+func sortedKernels(kernels map[string][]string) (versions, families []string) {
+	var names []string
+	for family := range kernels {
+		names = append(names, family)
+	}
+	sort.Strings(names)
+
+	for _, family := range names {
+		list := append([]string(nil), kernels[family]...)
+		sort.Sort(byVersion(list))
+		for _, version := range list {
+			versions = append(versions, version)
+			families = append(families, family)
+		}
+	}
+
+	return versions, families
+}
+
+// byVersion sorts kernel versions such as 3.12-x86_64 by their numeric
+// components, so that 4.10 comes after 4.4.
+type byVersion []string
+
+func (v byVersion) Len() int           { return len(v) }
+func (v byVersion) Swap(i, j int)      { v[i], v[j] = v[j], v[i] }
+func (v byVersion) Less(i, j int) bool { return compareVersions(v[i], v[j]) < 0 }
+
+// compareVersions compares a and b run by run, runs of digits numerically
+// and everything else as text. It returns -1, 0 or 1 like strings.Compare.
+func compareVersions(a, b string) int {
+	for a != "" && b != "" {
+		var x, y string
+		x, a = versionRun(a)
+		y, b = versionRun(b)
+		if x == y {
+			continue
+		}
+		if isDigit(x[0]) && isDigit(y[0]) {
+			x = strings.TrimLeft(x, "0")
+			y = strings.TrimLeft(y, "0")
+			if len(x) != len(y) {
+				if len(x) < len(y) {
+					return -1
+				}
+				return 1
+			}
+		}
+		if c := strings.Compare(x, y); c != 0 {
+			return c
+		}
+	}
+
+	return strings.Compare(a, b)
+}
+
+// versionRun splits the leading run of digits or non-digits off s.
+func versionRun(s string) (run, rest string) {
+	i := 1
+	for i < len(s) && isDigit(s[i]) == isDigit(s[0]) {
+		i++
+	}
+
+	return s[:i], s[i:]
+}
+
+func isDigit(c byte) bool {
+	return '0' <= c && c <= '9'
+}
+
+// chooseBootKernel offers to change the kernel of the boot disk of the
+// selected virtual machine.
+func (a *app) chooseBootKernel() {
+	a.Lock()
+	if len(a.list) == 0 {
+		a.Unlock()
+		return
+	}
+	vm := a.list[a.selector]
+	disk, ok := bootDisk(vm.ID, a.disks)
+	if !ok {
+		showError(a.uiError, fmt.Errorf("%s has no boot disk", vm.Hostname))
+		a.render()
+		a.Unlock()
+		return
+	}
+	a.Unlock()
+
+	a.chooseKernel(disk)
+}
+
+// chooseKernel offers the kernels available in the datacenter of disk and
+// switches disk to the chosen one via hosting.disk.update.
+func (a *app) chooseKernel(disk gandi.DiskReturn) {
+	a.Lock()
+	client := a.client
+	if disk.Type == "snapshot" {
+		showError(a.uiError, fmt.Errorf("%s is a snapshot, its kernel cannot be changed", disk.Name))
+		a.render()
+		a.Unlock()
+		return
+	}
+	a.Unlock()
+
+	kernels, err := client.DiskListKernels(disk.DatacenterID)
+
+	a.Lock()
+	defer a.Unlock()
+
+	showError(a.uiError, err)
+	if err != nil || client != a.client {
+		a.render()
+		return
+	}
+
+	versions, families := sortedKernels(kernels)
+	if len(versions) == 0 {
+		showError(a.uiError, fmt.Errorf("no kernels available in %s", datacenterName(a.dcs, disk.DatacenterID)))
+		a.render()
+		return
+	}
+
+	names := make([]string, len(versions))
+	current := -1
+	for i, version := range versions {
+		names[i] = families[i] + "  " + version
+		if version == disk.KernelVersion {
+			names[i] += "  (current)"
+			current = i
+		}
+	}
+
+	var kernel string
+
+	a.dialog = newWizard(
+		func(next func()) dialog {
+			c := newChooser("Kernel of "+disk.Name, names, func(i int) {
+				kernel = versions[i]
+				if kernel != disk.KernelVersion {
+					next()
+				}
+			})
+			c.Select(current)
+			return c
+		},
+		func(next func()) dialog {
+			old := disk.KernelVersion
+			if old == "" {
+				old = "none"
+			}
+			if current < 0 && old != "none" {
+				old += ", no longer available"
+			}
+			lines := []string{fmt.Sprintf("The kernel of %s changes from %s to %s.", disk.Name, old, kernel)}
+			if vms := attachedTo(disk, a.vms); vms != "" && disk.IsBootDisk {
+				lines = append(lines, "", "[Reboot "+vms+" to boot the new kernel.](fg-yellow)")
+			}
+			return newConfirmation("Change kernel of "+disk.Name, lines, func() {
+				next()
+				// Called from handleKey with the lock held
+				go func() {
+					op, err := client.DiskUpdate(disk.ID, gandi.DiskUpdateSpec{Kernel: kernel})
+					a.track(client, disk.Name, op, err, nil)
+				}()
+			})
+		},
+	)
+	a.render()
+}
@@ -0,0 +1,43 @@
+// Copyright 2017, Carlo Strub <cs@carlostrub.ch>
+// BSD 3-Clause License, see LICENSE file for details.
+
+package main
+
+import "testing"
+
+func TestCompareVersions(t *testing.T) {
+	for _, c := range []struct {
+		a, b string
+		want int
+	}{
+		{"4.4", "4.4", 0},
+		{"4.4", "4.10", -1},
+		{"3.18", "3.2", 1},
+		{"3.2", "4.1", -1},
+		{"3.12-x86_64", "3.18-x86_64", -1},
+		{"4.4-x86_64 (hvm)", "4.10-x86_64 (hvm)", -1},
+
+		// Leading zeros do not count
+		{"4.04", "4.4", 0},
+		{"4.010", "4.9", 1},
+		{"4.0", "4.00", 0},
+
+		// Suffixes compare after the version, their numbers numerically
+		{"4.4-rc2", "4.4-rc10", -1},
+		{"4.4-rc1", "4.10-rc1", -1},
+		{"4.10-rc1", "4.4", 1},
+		{"4.4-gandi", "4.4-rc1", -1},
+		{"4.4-gandi", "4.4", 1},
+		{"3.18-gandi", "3.2-gandi", 1},
+
+		{"", "", 0},
+		{"", "4.4", -1},
+	} {
+		if got := compareVersions(c.a, c.b); got != c.want {
+			t.Errorf("compareVersions(%q, %q) = %d, want %d", c.a, c.b, got, c.want)
+		}
+		if got := compareVersions(c.b, c.a); got != -c.want {
+			t.Errorf("compareVersions(%q, %q) = %d, want %d", c.b, c.a, got, -c.want)
+		}
+	}
+}
@@ -0,0 +1,276 @@
+// Copyright 2017, Carlo Strub <cs@carlostrub.ch>
+// BSD 3-Clause License, see LICENSE file for details.
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"cost.li/bapu/gandi"
+	"github.com/gizak/termui"
+)
+
+// localKey is a public SSH key found on this machine, to be imported into
+// the account.
+type localKey struct {
+	Source      string // file name or ssh-agent
+	Value       string
+	Fingerprint string
+	Name        string // suggested name
+}
+
+// localKeys returns the public keys in ~/.ssh/*.pub and those held by
+// ssh-agent, each only once. Unreadable files are skipped.
+func localKeys() ([]localKey, error) {
+	var keys []localKey
+	seen := make(map[string]bool)
+	add := func(source, value, name string) {
+		fingerprint, err := gandi.SSHFingerprint(value)
+		if err != nil || seen[fingerprint] {
+			return
+		}
+		seen[fingerprint] = true
+		if fields := strings.Fields(value); len(fields) > 2 {
+			name = fields[2]
+		}
+		keys = append(keys, localKey{
+			Source:      source,
+			Value:       value,
+			Fingerprint: fingerprint,
+			Name:        name,
+		})
+	}
+
+	paths, _ := filepath.Glob(filepath.Join(os.Getenv("HOME"), ".ssh", "*.pub"))
+	for _, path := range paths {
+		if value, err := readSSHKey(path); err == nil {
+			base := filepath.Base(path)
+			add(base, value, strings.TrimSuffix(base, ".pub"))
+		}
+	}
+
+	values, err := agentKeys()
+	for _, value := range values {
+		add("ssh-agent", value, "agent")
+	}
+
+	return keys, err
+}
+
+// keyNamed returns the SSH key among keys with the given name, or nil.
+func keyNamed(keys []gandi.SSHKeyReturn, name string) *gandi.SSHKeyReturn {
+	for i := range keys {
+		if keys[i].Name == name {
+			return &keys[i]
+		}
+	}
+
+	return nil
+}
+
+// keyRows returns the rows of the SSH key table.
+func keyRows(list []gandi.SSHKeyReturn, selector int) (keys [][]string) {
+	keys = append(keys, []string{
+		"Selected",
+		"Name",
+		"Fingerprint",
+		"ID",
+	})
+
+	for i, val := range list {
+		s := ""
+		if selector == i {
+			s = "*"
+		}
+		keys = append(keys, []string{
+			s,
+			val.Name,
+			val.Fingerprint,
+			strconv.Itoa(val.ID),
+		})
+	}
+
+	return keys
+}
+
+// colorKeyRows resets the colors of the SSH key table, whose rows have no
+// state to highlight.
+func colorKeyRows(table *termui.Table, list []gandi.SSHKeyReturn) {
+	colorTable(table, len(list), nil)
+}
+
+// selectedKey returns the selected SSH key of the key tab. The caller must
+// hold the lock.
+func (a *app) selectedKey() (gandi.SSHKeyReturn, bool) {
+	if len(a.keyList) == 0 {
+		return gandi.SSHKeyReturn{}, false
+	}
+
+	return a.keyList[a.keySelector], true
+}
+
+// handleKeyKey processes the key presses of the SSH key tab.
+func (a *app) handleKeyKey(key string) {
+	switch key {
+	case "i":
+		a.importKey()
+	case "d":
+		a.deleteKey()
+	case "<enter>":
+		a.showKey()
+	}
+}
+
+// finish shows err of a call via client which returns no operation, and
+// refreshes to show its effect. Results of a client which is no longer in
+// use are ignored.
+func (a *app) finish(client *gandi.Client, err error) {
+	a.Lock()
+	defer a.Unlock()
+
+	if client != a.client {
+		return
+	}
+	showError(a.uiError, err)
+	if err == nil {
+		a.refresh.Trigger()
+	}
+	a.render()
+}
+
+// showKey fetches the selected SSH key via hosting.ssh.info and opens a
+// dialog with its value.
+func (a *app) showKey() {
+	a.Lock()
+	key, ok := a.selectedKey()
+	client := a.client
+	a.Unlock()
+	if !ok {
+		return
+	}
+
+	key, err := client.SSHKeyInfo(key.ID)
+
+	a.Lock()
+	defer a.Unlock()
+
+	showError(a.uiError, err)
+	if err == nil {
+		lines := []string{
+			fmt.Sprintf("Name:         %s (ID %d)", key.Name, key.ID),
+			fmt.Sprintf("Fingerprint:  %s", key.Fingerprint),
+			"",
+			"Public key",
+		}
+		// Keys are too long for a single line
+		const width = 64
+		for value := key.Value; value != ""; {
+			n := width
+			if len(value) < n {
+				n = len(value)
+			}
+			lines = append(lines, "  "+value[:n])
+			value = value[n:]
+		}
+		a.dialog = newViewer("SSH key "+key.Name, lines)
+	}
+	a.render()
+}
+
+// importKey offers the public keys of this machine and of ssh-agent, asks
+// for a name and registers the chosen key via hosting.ssh.create.
+func (a *app) importKey() {
+	a.Lock()
+	client := a.client
+	a.Unlock()
+
+	keys, err := localKeys()
+
+	a.Lock()
+	defer a.Unlock()
+
+	if err == nil && len(keys) == 0 {
+		err = errors.New("no public keys in ~/.ssh and no keys in ssh-agent")
+	}
+	showError(a.uiError, err)
+	if len(keys) == 0 || client != a.client {
+		a.render()
+		return
+	}
+
+	registered := make(map[string]string)
+	for _, key := range a.keys {
+		registered[key.Fingerprint] = key.Name
+	}
+	var names []string
+	for _, key := range keys {
+		name := fmt.Sprintf("%-16s %s", key.Source, key.Fingerprint)
+		if other, ok := registered[key.Fingerprint]; ok {
+			name += " (registered as " + other + ")"
+		}
+		names = append(names, name)
+	}
+	taken := a.keys
+
+	var key localKey
+	a.dialog = newWizard(
+		func(next func()) dialog {
+			return newChooser("Import SSH key", names, func(i int) {
+				key = keys[i]
+				next()
+			})
+		},
+		func(next func()) dialog {
+			if other, ok := registered[key.Fingerprint]; ok {
+				showError(a.uiError, fmt.Errorf("%s is already registered as %s", key.Source, other))
+				return nil
+			}
+			validate := func(input string) error {
+				if strings.TrimSpace(input) == "" {
+					return errors.New("name must not be empty")
+				}
+				if keyNamed(taken, strings.TrimSpace(input)) != nil {
+					return errors.New("name is already in use")
+				}
+				return nil
+			}
+			return newPrompt("Import "+key.Source, "Name", key.Name, validate, func(input string) {
+				name := strings.TrimSpace(input)
+				// Called from handleKey with the lock held
+				go func() {
+					_, err := client.SSHKeyCreate(name, key.Value)
+					a.finish(client, err)
+				}()
+			})
+		},
+	)
+	a.render()
+}
+
+// deleteKey removes the selected SSH key from the account after
+// confirmation.
+func (a *app) deleteKey() {
+	a.Lock()
+	defer a.Unlock()
+
+	key, ok := a.selectedKey()
+	if !ok {
+		return
+	}
+	client := a.client
+
+	a.dialog = newConfirmation("Delete SSH key "+key.Name, []string{
+		fmt.Sprintf("SSH key %s (%s) is removed from the account.", key.Name, key.Fingerprint),
+		"Virtual machines it was installed on keep it.",
+	}, func() {
+		go func() {
+			a.finish(client, client.SSHKeyDelete(key.ID))
+		}()
+	})
+	a.render()
+}
@@ -4,111 +4,22 @@
 package main
 
 import (
-	"errors"
+	"fmt"
 	"log"
 	"os"
 	"strconv"
-	"time"
 
+	"cost.li/bapu/gandi"
 	"github.com/gizak/termui"
-	"github.com/kolo/xmlrpc"
+	"github.com/spf13/pflag"
 	"github.com/spf13/viper"
 )
 
-var selector int
-
-// AccountReturn contains fields for informations about the Gandi account
-type AccountReturn struct {
-	AverageCreditCost     float64   `xmlrpc:"average_credit_cost"`
-	Credits               int       `xmlrpc:"credits"`
-	CycleDay              int       `xmlrpc:"cycle_day"`
-	DateCreditsExpiration time.Time `xmlrpc:"date_credits_expiration"`
-	FullName              string    `xmlrpc:"fullname"`
-	Handle                string    `xmlrpc:"handle"`
-	ID                    int       `xmlrpc:"id"`
-}
-
-// DiskReturn contains fields for informations about the Disks
-type DiskReturn struct {
-	CanSnapshot   bool      `xmlrpc:"can_snapshot"`
-	DatacenterID  int       `xmlrpc:"datacenter_id"`
-	DateCreated   time.Time `xmlrpc:"date_created"`
-	DateUpdated   time.Time `xmlrpc:"date_updated"`
-	ID            int       `xmlrpc:"id"`
-	IsBootDisk    bool      `xmlrpc:"is_boot_disk"`
-	KernelVersion string    `xmlrpc:"kernel_version"`
-	Label         string    `xmlrpc:"label"`
-	Name          string    `xmlrpc:"name"`
-	Size          int       `xmlrpc:"size"`
-	State         string    `xmlrpc:"state"`
-	TotalSize     int       `xmlrpc:"total_size"`
-	Type          string    `xmlrpc:"type"`
-	Visibility    string    `xmlrpc:"visibility"`
-}
-
-// VMReturn contains fields for informations about the virtual machines
-type VMReturn struct {
-	AiActive     int          `xmlrpc:"ai_active"`
-	Console      int          `xmlrpc:"console"`
-	ConsoleURL   string       `xmlrpc:"console_url"`
-	Cores        int          `xmlrpc:"cores"`
-	DatacenterID int          `xmlrpc:"datacenter_id"`
-	DateCreated  time.Time    `xmlrpc:"date_created"`
-	DateUpdated  time.Time    `xmlrpc:"date_updated"`
-	Description  string       `xmlrpc:"description"`
-	Disks        []DiskReturn `xmlrpc:"disks"`
-	Farm         string       `xmlrpc:"farm"`
-	FlexShares   int          `xmlrpc:"flex_shares"`
-	Hostname     string       `xmlrpc:"hostname"`
-	HVMState     string       `xmlrpc:"hvm_state"`
-	ID           int          `xmlrpc:"id"`
-	Memory       int          `xmlrpc:"memory"`
-	State        string       `xmlrpc:"state"`
-	VMmaxMemory  int          `xmlrpc:"vm_max_memory"`
-}
-
-// LoadAPI returns the api and apiKey according to the settings defined in the
-// configuration file, respectively.
-func LoadAPI() (api *xmlrpc.Client, apiKey string, err error) {
-	viper.SetConfigName("bapu")
-
-	homePath := os.Getenv("HOME")
-	viper.AddConfigPath(homePath)
-	viper.AddConfigPath("/usr/local/etc")
-	viper.AddConfigPath("/etc")
-
-	err = viper.ReadInConfig()
-	if err != nil {
-		return api, apiKey, err
-	}
-
-	production := viper.GetBool("production.enabled")
-	if production {
-		apiKey = viper.GetString("production.apiKey")
-		api, err = xmlrpc.NewClient("https://rpc.gandi.net/xmlrpc/", nil)
-		if err != nil {
-			return api, apiKey, err
-		}
-	}
-
-	development := viper.GetBool("development.enabled")
-	if development {
-		log.Println("Development Config found")
-		api, err = xmlrpc.NewClient("https://rpc.ote.gandi.net/xmlrpc/", nil)
-		if err != nil {
-			return api, apiKey, err
-		}
-		apiKey = viper.GetString("development.apiKey")
-	}
-
-	if api == nil {
-		return api, apiKey, errors.New("neither production nor development environment enabled in config")
-	}
-
-	return api, apiKey, nil
-}
-
-func serverList(list []VMReturn) (servers [][]string) {
+// serverList returns the rows of the server table, showing the kernel of
+// the boot disk of each virtual machine among disks. If grouped is set, list
+// is sorted by datacenter and the datacenter is only named on the first
+// row of its group.
+func serverList(list []gandi.VMReturn, selector int, disks []gandi.DiskReturn, datacenters []gandi.DatacenterReturn, grouped bool) (servers [][]string) {
 
 	servers = append(servers, []string{
 		"Selected",
@@ -117,6 +28,7 @@ func serverList(list []VMReturn) (servers [][]string) {
 		"Cores",
 		"Memory",
 		"State",
+		"Kernel",
 	})
 
 	for i, val := range list {
@@ -124,237 +36,161 @@ func serverList(list []VMReturn) (servers [][]string) {
 		if selector == i {
 			s = "*"
 		}
+		dc := datacenterName(datacenters, val.DatacenterID)
+		if grouped && i > 0 && list[i-1].DatacenterID == val.DatacenterID {
+			dc = ""
+		}
+		kernel := "-"
+		if disk, ok := bootDisk(val.ID, disks); ok {
+			kernel = disk.KernelVersion
+		}
 		servers = append(servers, []string{
 			s,
 			val.Hostname,
-			strconv.Itoa(val.DatacenterID),
+			dc,
 			strconv.Itoa(val.Cores),
 			strconv.Itoa(val.Memory) + "MB",
 			val.State,
+			kernel,
 		})
 	}
 
 	return servers
 }
 
-func main() {
-	// Load API
-	api, apiKey, err := LoadAPI()
-	if err != nil {
-		log.Fatal(err)
+// colorTable colors the n rows of table below its header with the colors
+// color returns for them. Rows color returns no colors for, or all rows if
+// color is nil, get the colors of the table itself.
+func colorTable(table *termui.Table, n int, color func(i int) (bg, fg termui.Attribute, ok bool)) {
+	// The header takes the first row
+	for len(table.BgColors) < n+1 {
+		table.BgColors = append(table.BgColors, table.BgColor)
+		table.FgColors = append(table.FgColors, table.FgColor)
 	}
 
-	// initialize termui
-	err = termui.Init()
-	if err != nil {
-		log.Fatal(err)
-	}
-	defer termui.Close()
-
-	// Title
-	uiTitle := termui.NewPar("Bapu -- Control your Gandi Machines")
-	uiTitle.Border = false
-	uiTitle.Height = 3
-	uiTitle.TextFgColor = termui.ColorMagenta
-
-	// Summary
-	var hostingVMCount *int
-	err = api.Call("hosting.vm.count", apiKey, &hostingVMCount)
-	if err != nil {
-		log.Fatal(err)
-	}
-	var hostingAccountInfo *AccountReturn
-	err = api.Call("hosting.account.info", apiKey, &hostingAccountInfo)
-	if err != nil {
-		log.Fatal(err)
-	}
-
-	info := *hostingAccountInfo
-
-	uiSummary := termui.NewPar("Owner: " + info.FullName + "    Virtual Machines: " + strconv.Itoa(*hostingVMCount) + "    Remaining Credit: " + strconv.Itoa(info.Credits))
-	uiSummary.Height = 3
-	uiSummary.Border = true
-	uiSummary.BorderLabel = "Summary"
-	uiSummary.TextFgColor = termui.ColorWhite
-
-	// List instances
-	var hostingVMList *[]VMReturn
-	err = api.Call("hosting.vm.list", apiKey, &hostingVMList)
-	if err != nil {
-		log.Fatal(err)
+	for i := 0; i < n; i++ {
+		table.BgColors[i+1] = table.BgColor
+		table.FgColors[i+1] = table.FgColor
+		if color == nil {
+			continue
+		}
+		if bg, fg, ok := color(i); ok {
+			table.BgColors[i+1] = bg
+			table.FgColors[i+1] = fg
+		}
 	}
+}
 
-	list := *hostingVMList
-
-	uiTable := termui.NewTable()
-	uiTable.Rows = serverList(list)
-	uiTable.FgColor = termui.ColorWhite
-	uiTable.BgColor = termui.ColorDefault
-	uiTable.TextAlign = termui.AlignCenter
-	uiTable.Seperator = false
-	uiTable.Analysis()
-	uiTable.SetSize()
-	uiTable.BgColors[0] = termui.ColorWhite
-	uiTable.FgColors[0] = termui.ColorBlack
-	uiTable.Y = 20
-	uiTable.X = 0
-	uiTable.Border = false
-	for i := 0; i < len(list); i++ {
+// colorRows colors the rows of the server table according to the state of
+// the respective virtual machine.
+func colorRows(table *termui.Table, list []gandi.VMReturn) {
+	colorTable(table, len(list), func(i int) (bg, fg termui.Attribute, ok bool) {
 		switch list[i].State {
 		case "paused":
-			uiTable.BgColors[i+1] = termui.ColorBlack
-			uiTable.FgColors[i+1] = termui.ColorWhite
+			return termui.ColorBlack, termui.ColorWhite, true
 		case "running":
-			uiTable.BgColors[i+1] = termui.ColorBlue
-			uiTable.FgColors[i+1] = termui.ColorWhite
+			return termui.ColorBlue, termui.ColorWhite, true
 		case "halted":
-			uiTable.BgColors[i+1] = termui.ColorYellow
-			uiTable.FgColors[i+1] = termui.ColorBlack
+			return termui.ColorYellow, termui.ColorBlack, true
 		case "locked":
-			uiTable.BgColors[i+1] = termui.ColorMagenta
-			uiTable.FgColors[i+1] = termui.ColorGreen
+			return termui.ColorMagenta, termui.ColorGreen, true
 		case "being_created":
-			uiTable.BgColors[i+1] = termui.ColorWhite
-			uiTable.FgColors[i+1] = termui.ColorBlack
+			return termui.ColorWhite, termui.ColorBlack, true
 		case "deleted":
-			uiTable.BgColors[i+1] = termui.ColorBlack
-			uiTable.FgColors[i+1] = termui.ColorRed
+			return termui.ColorBlack, termui.ColorRed, true
 		}
-	}
 
-	// Commands
-	uiCommands := termui.NewPar("<[S]tart>    <St[o]p>    <[R]eboot>  Virtual Machine |   <[Q]uit>")
-	uiCommands.Height = 3
-	uiCommands.Border = false
-	uiCommands.BorderLabel = "Summary"
-	uiCommands.TextFgColor = termui.ColorBlack
-	uiCommands.TextBgColor = termui.ColorWhite
+		return 0, 0, false
+	})
+}
 
-	// Create termui Grid system
-	termui.Body.AddRows(
-		termui.NewRow(
-			termui.NewCol(12, 0, uiTitle),
-		),
-		termui.NewRow(
-			termui.NewCol(12, 0, uiSummary),
-		),
-		termui.NewRow(
-			termui.NewCol(12, 0, uiTable),
-		),
-		termui.NewRow(
-			termui.NewCol(12, 0, uiCommands),
-		),
-	)
+// showError displays err in the error bar. A nil err clears the bar.
+func showError(bar *termui.Par, err error) {
+	if err == nil {
+		bar.Text = ""
+		return
+	}
 
-	// calculate layout
-	termui.Body.Align()
-	termui.Render(termui.Body)
+	bar.Text = " Error: " + err.Error() + "  <Esc> to dismiss"
+}
 
-	// Quit with q
-	termui.Handle("/sys/kbd/q", func(termui.Event) {
-		termui.StopLoop()
-	})
+// fatal restores the terminal before exiting with err.
+func fatal(err error) {
+	termui.Close()
+	log.Fatal(err)
+}
 
-	termui.Handle("/sys/kbd/<up>", func(termui.Event) {
-		if selector > 0 {
-			selector--
-		}
-		uiTable.Rows = serverList(list)
-		termui.Render(termui.Body)
-	})
+// usage describes the command line of bapu.
+func usage() {
+	fmt.Fprintf(os.Stderr, "Usage: bapu [options] [command]\n\n")
+	fmt.Fprintf(os.Stderr, "Without command, bapu opens the terminal UI. Commands:\n")
+	printCommands(os.Stderr)
+	fmt.Fprintf(os.Stderr, "\nOptions:\n")
+	pflag.PrintDefaults()
+}
 
-	termui.Handle("/sys/kbd/<down>", func(termui.Event) {
-		if selector < len(list)-1 {
-			selector++
+func main() {
+	var opts cliOptions
+	profileName := pflag.StringP("profile", "p", "", "profile of bapu.toml to use")
+	pflag.BoolVarP(&opts.Wait, "wait", "w", false, "wait for the operations of vm start, stop and reboot to finish")
+	pflag.StringVarP(&opts.Output, "output", "o", "", "format of listings: table, json, yaml, csv or template (default table)")
+	pflag.StringVar(&opts.Template, "template", "", "Go text/template applied to every listed item, such as '{{.hostname}} {{.state}}'")
+	pflag.Usage = usage
+	pflag.Parse()
+
+	if pflag.NArg() > 0 {
+		log.SetFlags(0)
+		log.SetPrefix("bapu: ")
+
+		cmd, args, err := findCommand(pflag.Args())
+		if err == nil {
+			err = checkOutput(&opts)
 		}
-		uiTable.Rows = serverList(list)
-		termui.Render(termui.Body)
-	})
-
-	termui.Handle("/sys/kbd/s", func(termui.Event) {
-		err = api.Call("hosting.vm.start", []interface{}{apiKey, list[selector].ID}, nil)
 		if err != nil {
-			log.Fatal(err)
+			log.Printf("%v\n\n", err)
+			usage()
+			os.Exit(2)
 		}
 
-		confirmation := termui.NewPar(list[selector].Hostname + " (ID " + strconv.Itoa(list[selector].ID) + ") is being started")
-		confirmation.Height = 4
-		confirmation.Width = 50
-		confirmation.Y = 5
-		confirmation.Border = true
-		termui.Render(confirmation)
-	})
-
-	termui.Handle("/sys/kbd/o", func(termui.Event) {
-		err = api.Call("hosting.vm.stop", []interface{}{apiKey, list[selector].ID}, nil)
+		client, _, err := LoadAPI(*profileName)
 		if err != nil {
 			log.Fatal(err)
 		}
-		confirmation := termui.NewPar(list[selector].Hostname + " (ID " + strconv.Itoa(list[selector].ID) + ") is being stopped")
-		confirmation.Height = 4
-		confirmation.Width = 50
-		confirmation.Y = 5
-		confirmation.Border = true
-		termui.Render(confirmation)
-	})
-
-	termui.Handle("/sys/kbd/r", func(termui.Event) {
-		err = api.Call("hosting.vm.reboot", []interface{}{apiKey, list[selector].ID}, nil)
+		err = cmd.Run(client, args, opts)
 		if err != nil {
 			log.Fatal(err)
 		}
-		confirmation := termui.NewPar(list[selector].Hostname + " (ID " + strconv.Itoa(list[selector].ID) + ") is being rebooted")
-		confirmation.Height = 4
-		confirmation.Width = 50
-		confirmation.Y = 5
-		confirmation.Border = true
-		termui.Render(confirmation)
-	})
+		return
+	}
 
-	termui.Handle("/timer/1s", func(e termui.Event) {
-		t := e.Data.(termui.EvtTimer)
-		// t is a EvtTimer
-		if t.Count%2 == 0 {
-			termui.Body.Align()
-			termui.Render(termui.Body)
-		}
-	})
-	termui.Handle("/timer/1s", func(e termui.Event) {
-		t := e.Data.(termui.EvtTimer)
-		// t is a EvtTimer
-		if t.Count%4 == 0 {
-			err = api.Call("hosting.vm.list", apiKey, &hostingVMList)
-			if err != nil {
-				log.Fatal(err)
-			}
+	// Load API
+	client, profile, err := LoadAPI(*profileName)
+	if err != nil {
+		log.Fatal(err)
+	}
 
-			list = *hostingVMList
-			uiTable.Rows = serverList(list)
-			for i := 0; i < len(list); i++ {
-				switch list[i].State {
-				case "paused":
-					uiTable.BgColors[i+1] = termui.ColorBlack
-					uiTable.FgColors[i+1] = termui.ColorWhite
-				case "running":
-					uiTable.BgColors[i+1] = termui.ColorBlue
-					uiTable.FgColors[i+1] = termui.ColorWhite
-				case "halted":
-					uiTable.BgColors[i+1] = termui.ColorYellow
-					uiTable.FgColors[i+1] = termui.ColorBlack
-				case "locked":
-					uiTable.BgColors[i+1] = termui.ColorMagenta
-					uiTable.FgColors[i+1] = termui.ColorGreen
-				case "being_created":
-					uiTable.BgColors[i+1] = termui.ColorWhite
-					uiTable.FgColors[i+1] = termui.ColorBlack
-				case "deleted":
-					uiTable.BgColors[i+1] = termui.ColorBlack
-					uiTable.FgColors[i+1] = termui.ColorRed
-				}
-			}
-			termui.Render(termui.Body)
-		}
-	})
+	viper.SetDefault("refreshInterval", "4s")
+	viper.SetDefault("refreshTimeout", "10s")
+	refreshInterval := viper.GetDuration("refreshInterval")
+	if refreshInterval <= 0 {
+		log.Fatal("refreshInterval must be a positive duration, e.g. \"4s\"")
+	}
+	refreshTimeout := viper.GetDuration("refreshTimeout")
+	if refreshTimeout <= 0 {
+		log.Fatal("refreshTimeout must be a positive duration, e.g. \"10s\"")
+	}
+
+	// initialize termui
+	err = termui.Init()
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer termui.Close()
+
+	a := newApp(refreshInterval, refreshTimeout)
+	a.Lock()
+	a.connect(client, profile)
+	a.Unlock()
 
-	termui.Loop()
+	a.run()
 }
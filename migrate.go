@@ -0,0 +1,108 @@
+// Copyright 2017, Carlo Strub <cs@carlostrub.ch>
+// BSD 3-Clause License, see LICENSE file for details.
+
+package main
+
+import (
+	"fmt"
+
+	"cost.li/bapu/gandi"
+)
+
+// migrateVM offers the datacenters the selected virtual machine can be
+// migrated to.
+func (a *app) migrateVM() {
+	a.Lock()
+	if len(a.list) == 0 {
+		a.Unlock()
+		return
+	}
+	client := a.client
+	cache := a.datacenters
+	vm := a.list[a.selector]
+	a.Unlock()
+
+	datacenters, err := cache.List()
+
+	a.Lock()
+	defer a.Unlock()
+
+	showError(a.uiError, err)
+	if err != nil || client != a.client {
+		a.render()
+		return
+	}
+
+	var targets []gandi.DatacenterReturn
+	var names []string
+	for _, dc := range datacenters {
+		if dc.ID != vm.DatacenterID {
+			targets = append(targets, dc)
+			names = append(names, fmt.Sprintf("%s (%s)", dc.Name, dc.ISO))
+		}
+	}
+
+	a.dialog = newChooser("Migrate "+vm.Hostname+" to", names, func(i int) {
+		// Called from handleKey with the lock held
+		go a.checkMigration(client, vm, targets[i])
+	})
+	a.render()
+}
+
+// checkMigration calls hosting.vm.can_migrate and asks for confirmation,
+// along with its warnings, if vm can be migrated to dc, or shows why not.
+func (a *app) checkMigration(client *gandi.Client, vm gandi.VMReturn, dc gandi.DatacenterReturn) {
+	result, err := client.VMCanMigrate(vm.ID, dc.ID)
+
+	a.Lock()
+	defer a.Unlock()
+
+	showError(a.uiError, err)
+	if err != nil || client != a.client || a.dialog != nil {
+		a.render()
+		return
+	}
+
+	if !result.CanMigrate {
+		lines := []string{vm.Hostname + " cannot be migrated to " + dc.Name + ":"}
+		for _, reason := range result.Matched {
+			lines = append(lines, "  "+reason)
+		}
+		a.dialog = newViewer("Migrate "+vm.Hostname, lines)
+		a.render()
+		return
+	}
+
+	lines := []string{
+		vm.Hostname + " can be migrated to " + dc.Name + ".",
+		"Phase 1 copies the disks of " + vm.Hostname + " to " + dc.Name + " while it keeps running.",
+		"Phase 2 moves " + vm.Hostname + " over, which takes it offline for a short time.",
+		"Phase 2 starts as soon as phase 1 is done.",
+	}
+	// What matched although the migration is possible is worth a warning
+	if len(result.Matched) > 0 {
+		lines = append(lines, "", "Warnings:")
+		for _, warning := range result.Matched {
+			lines = append(lines, "  "+warning)
+		}
+	}
+	a.dialog = newConfirmation("Migrate "+vm.Hostname+" to "+dc.Name, lines, func() {
+		// Called from handleKey with the lock held
+		go a.runMigration(client, vm, dc)
+	})
+	a.render()
+}
+
+// runMigration migrates vm to dc: it copies the disks and finalizes the
+// migration once they are copied.
+func (a *app) runMigration(client *gandi.Client, vm gandi.VMReturn, dc gandi.DatacenterReturn) {
+	label := vm.Hostname + " to " + dc.Name
+
+	op, err := client.VMMigrate(vm.ID, dc.ID, false)
+	a.track(client, label+" (1/2)", op, err, func(op gandi.OperationReturn) {
+		if op.Step == gandi.StepDone {
+			op, err := client.VMMigrate(vm.ID, dc.ID, true)
+			a.track(client, label+" (2/2)", op, err, nil)
+		}
+	})
+}
@@ -0,0 +1,426 @@
+// Copyright 2017, Carlo Strub <cs@carlostrub.ch>
+// BSD 3-Clause License, see LICENSE file for details.
+
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"cost.li/bapu/gandi"
+	"github.com/gizak/termui"
+)
+
+// defaultBandwidth is the bandwidth offered for new interfaces, in kbit/s.
+const defaultBandwidth = 102400
+
+// ipsOf returns the IP addresses among ips bound to the network interface
+// with the given id.
+func ipsOf(ifaceID int, ips []gandi.IPReturn) (bound []gandi.IPReturn) {
+	for _, ip := range ips {
+		if ip.IfaceID == ifaceID {
+			bound = append(bound, ip)
+		}
+	}
+
+	return bound
+}
+
+// addresses returns the IP addresses of the given version among ips, comma
+// separated.
+func addresses(ips []gandi.IPReturn, version int) string {
+	var list []string
+	for _, ip := range ips {
+		if ip.Version == version {
+			list = append(list, ip.IP)
+		}
+	}
+
+	return strings.Join(list, ", ")
+}
+
+// reverses returns the distinct reverse DNS names of ips, comma separated.
+func reverses(ips []gandi.IPReturn) string {
+	var names []string
+	for _, ip := range ips {
+		seen := false
+		for _, name := range names {
+			seen = seen || name == ip.Reverse
+		}
+		if !seen && ip.Reverse != "" {
+			names = append(names, ip.Reverse)
+		}
+	}
+
+	return strings.Join(names, ", ")
+}
+
+// bandwidth formats a bandwidth given in kbit/s.
+func bandwidth(kbits float64) string {
+	if kbits >= 1024 {
+		return strconv.FormatFloat(kbits/1024, 'f', -1, 64) + " Mbit/s"
+	}
+
+	return strconv.FormatFloat(kbits, 'f', -1, 64) + " kbit/s"
+}
+
+// ifaceRows returns the rows of the network interface table. If grouped is
+// set, list is sorted by datacenter and the datacenter is only named on the
+// first row of its group.
+func ifaceRows(list []gandi.IfaceReturn, selector int, ips []gandi.IPReturn, vms []gandi.VMReturn, datacenters []gandi.DatacenterReturn, grouped bool) (ifaces [][]string) {
+	ifaces = append(ifaces, []string{
+		"Selected",
+		"Interface",
+		"Type",
+		"Reverse DNS",
+		"IPv4",
+		"IPv6",
+		"Bandwidth",
+		"VLAN",
+		"Datacenter",
+		"Attached to",
+		"State",
+	})
+
+	for i, val := range list {
+		s := ""
+		if selector == i {
+			s = "*"
+		}
+		dc := datacenterName(datacenters, val.DatacenterID)
+		if grouped && i > 0 && list[i-1].DatacenterID == val.DatacenterID {
+			dc = ""
+		}
+		vm := "-"
+		if val.VMID != 0 {
+			vm = vmName(vms, val.VMID) + " #" + strconv.Itoa(val.Num)
+		}
+		vlan := val.VLAN.Name
+		if vlan == "" {
+			vlan = "-"
+		}
+		bound := ipsOf(val.ID, ips)
+		ifaces = append(ifaces, []string{
+			s,
+			strconv.Itoa(val.ID),
+			val.Type,
+			reverses(bound),
+			addresses(bound, 4),
+			addresses(bound, 6),
+			bandwidth(val.Bandwidth),
+			vlan,
+			dc,
+			vm,
+			val.State,
+		})
+	}
+
+	return ifaces
+}
+
+// colorIfaceRows colors the rows of the network interface table according to
+// the state of the respective interface. Free interfaces stand out, as their
+// addresses are paid for but unused.
+func colorIfaceRows(table *termui.Table, list []gandi.IfaceReturn) {
+	colorTable(table, len(list), func(i int) (bg, fg termui.Attribute, ok bool) {
+		switch list[i].State {
+		case "being_created", "being_attached", "being_detached", "deleting":
+			return termui.ColorWhite, termui.ColorBlack, true
+		case "free":
+			return termui.ColorYellow, termui.ColorBlack, true
+		}
+
+		return 0, 0, false
+	})
+}
+
+// selectedIface returns the selected network interface of the network tab.
+// The caller must hold the lock.
+func (a *app) selectedIface() (gandi.IfaceReturn, bool) {
+	if len(a.ifaceList) == 0 {
+		return gandi.IfaceReturn{}, false
+	}
+
+	return a.ifaceList[a.ifaceSelector], true
+}
+
+// handleIfaceKey processes the key presses of the network tab.
+func (a *app) handleIfaceKey(key string) {
+	switch key {
+	case "c":
+		a.createIface()
+	case "t":
+		a.attachIface()
+	case "x":
+		a.detachIface()
+	case "r":
+		a.releaseIface()
+	case "v":
+		a.editReverse()
+	case "<enter>":
+		a.showIface()
+	}
+}
+
+// showIface opens a dialog with everything known about the selected network
+// interface.
+func (a *app) showIface() {
+	a.Lock()
+	defer a.Unlock()
+
+	iface, ok := a.selectedIface()
+	if !ok {
+		return
+	}
+
+	vm := ""
+	if iface.VMID != 0 {
+		vm = vmName(a.vms, iface.VMID)
+	}
+	a.dialog = newViewer("Interface "+strconv.Itoa(iface.ID), ifaceDetails(iface, ipsOf(iface.ID, a.ips), datacenterName(a.dcs, iface.DatacenterID), vm))
+	a.render()
+}
+
+// createIface asks for the datacenter, IP version and bandwidth of a new
+// network interface and creates it via hosting.iface.create.
+func (a *app) createIface() {
+	a.Lock()
+	client := a.client
+	cache := a.datacenters
+	a.Unlock()
+
+	datacenters, err := cache.List()
+
+	a.Lock()
+	defer a.Unlock()
+
+	showError(a.uiError, err)
+	if err != nil || client != a.client {
+		a.render()
+		return
+	}
+
+	var spec gandi.IfaceCreateSpec
+	var dcName string
+	versions := []int{4, 6}
+
+	a.dialog = newWizard(
+		func(next func()) dialog {
+			var names []string
+			for _, dc := range datacenters {
+				names = append(names, datacenterName(datacenters, dc.ID))
+			}
+			return newChooser("Datacenter", names, func(i int) {
+				spec.DatacenterID = datacenters[i].ID
+				dcName = names[i]
+				next()
+			})
+		},
+		func(next func()) dialog {
+			return newChooser("IP address", []string{"IPv4", "IPv6"}, func(i int) {
+				spec.IPVersion = versions[i]
+				next()
+			})
+		},
+		func(next func()) dialog {
+			return newPrompt("New interface", "Bandwidth in kbit/s", strconv.Itoa(defaultBandwidth), intValidator(1), func(input string) {
+				n, _ := strconv.Atoi(strings.TrimSpace(input))
+				spec.Bandwidth = float64(n)
+				next()
+			})
+		},
+		func(next func()) dialog {
+			return newConfirmation("Create interface", []string{
+				"Datacenter:  " + dcName,
+				fmt.Sprintf("Address:     IPv%d", spec.IPVersion),
+				"Bandwidth:   " + bandwidth(spec.Bandwidth),
+			}, func() {
+				next()
+				// Called from handleKey with the lock held
+				go func() {
+					op, err := client.IfaceCreate(spec)
+					a.track(client, "interface", op, err, nil)
+				}()
+			})
+		},
+	)
+	a.render()
+}
+
+// attachIface offers the virtual machines the selected network interface
+// can be attached to: those in the same datacenter.
+func (a *app) attachIface() {
+	a.Lock()
+	defer a.Unlock()
+
+	iface, ok := a.selectedIface()
+	if !ok {
+		return
+	}
+	if iface.VMID != 0 {
+		showError(a.uiError, fmt.Errorf("interface %d is attached to %s already, detach it first", iface.ID, vmName(a.vms, iface.VMID)))
+		a.render()
+		return
+	}
+
+	var candidates []gandi.VMReturn
+	var names []string
+	for _, vm := range a.vms {
+		if vm.State != "deleted" && vm.DatacenterID == iface.DatacenterID {
+			candidates = append(candidates, vm)
+			names = append(names, vm.Hostname+" ("+vm.State+")")
+		}
+	}
+	if len(candidates) == 0 {
+		showError(a.uiError, fmt.Errorf("no virtual machine in %s to attach interface %d to", datacenterName(a.dcs, iface.DatacenterID), iface.ID))
+		a.render()
+		return
+	}
+
+	client := a.client
+	label := "interface " + strconv.Itoa(iface.ID)
+	a.dialog = newChooser("Attach "+label+" to", names, func(i int) {
+		go func() {
+			op, err := client.VMIfaceAttach(candidates[i].ID, iface.ID)
+			a.track(client, label, op, err, nil)
+		}()
+	})
+	a.render()
+}
+
+// detachIface detaches the selected network interface from its virtual
+// machine after confirmation.
+func (a *app) detachIface() {
+	a.Lock()
+	defer a.Unlock()
+
+	iface, ok := a.selectedIface()
+	if !ok {
+		return
+	}
+	if iface.VMID == 0 {
+		showError(a.uiError, fmt.Errorf("interface %d is not attached", iface.ID))
+		a.render()
+		return
+	}
+
+	vm := vmName(a.vms, iface.VMID)
+	lines := []string{fmt.Sprintf("Interface %d is detached from %s.", iface.ID, vm)}
+	for _, ip := range ipsOf(iface.ID, a.ips) {
+		lines = append(lines, fmt.Sprintf("%s no longer answers on %s.", vm, ip.IP))
+	}
+	others := 0
+	for _, other := range a.ifaces {
+		if other.VMID == iface.VMID && other.ID != iface.ID {
+			others++
+		}
+	}
+	if others == 0 {
+		lines = append(lines, "", "[It is the only interface of "+vm+", which loses all network access.](fg-yellow)")
+	}
+
+	client := a.client
+	label := "interface " + strconv.Itoa(iface.ID)
+	a.dialog = newConfirmation("Detach "+label, lines, func() {
+		go func() {
+			op, err := client.VMIfaceDetach(iface.VMID, iface.ID)
+			a.track(client, label, op, err, nil)
+		}()
+	})
+	a.render()
+}
+
+// releaseIface deletes the selected network interface after confirmation,
+// releasing its IP addresses. Only interfaces not attached to a virtual
+// machine can be released.
+func (a *app) releaseIface() {
+	a.Lock()
+	defer a.Unlock()
+
+	iface, ok := a.selectedIface()
+	if !ok {
+		return
+	}
+	if iface.VMID != 0 {
+		showError(a.uiError, fmt.Errorf("interface %d is used by %s, detach it first", iface.ID, vmName(a.vms, iface.VMID)))
+		a.render()
+		return
+	}
+
+	lines := []string{fmt.Sprintf("Interface %d is deleted together with its addresses:", iface.ID)}
+	for _, ip := range ipsOf(iface.ID, a.ips) {
+		lines = append(lines, fmt.Sprintf("  %s (IPv%d)", ip.IP, ip.Version))
+	}
+	lines = append(lines, "", "Released addresses cannot be recovered.")
+
+	client := a.client
+	label := "interface " + strconv.Itoa(iface.ID)
+	a.dialog = newConfirmation("Release "+label, lines, func() {
+		go func() {
+			op, err := client.IfaceDelete(iface.ID)
+			a.track(client, label, op, err, nil)
+		}()
+	})
+	a.render()
+}
+
+// editReverse asks for the reverse DNS of an IP address of the selected
+// network interface and sets it via hosting.ip.update, once the name
+// resolves to the address.
+func (a *app) editReverse() {
+	a.Lock()
+	defer a.Unlock()
+
+	iface, ok := a.selectedIface()
+	if !ok {
+		return
+	}
+	ips := ipsOf(iface.ID, a.ips)
+	if len(ips) == 0 {
+		showError(a.uiError, fmt.Errorf("interface %d has no IP address", iface.ID))
+		a.render()
+		return
+	}
+	client := a.client
+
+	var names []string
+	for _, ip := range ips {
+		names = append(names, fmt.Sprintf("%-39s  %s", ip.IP, ip.Reverse))
+	}
+	ip := ips[0]
+
+	a.dialog = newWizard(
+		func(next func()) dialog {
+			return newChooser("Reverse DNS of interface "+strconv.Itoa(iface.ID), names, func(i int) {
+				ip = ips[i]
+				next()
+			})
+		},
+		func(next func()) dialog {
+			return newPrompt("Reverse DNS of "+ip.IP, "Hostname", ip.Reverse, validateReverse, func(input string) {
+				next()
+				name := strings.TrimSpace(input)
+				if name == ip.Reverse {
+					return
+				}
+				go a.updateReverse(client, ip, name)
+			})
+		},
+	)
+	a.render()
+}
+
+// updateReverse points the reverse DNS of ip to name if name resolves to ip.
+func (a *app) updateReverse(client *gandi.Client, ip gandi.IPReturn, name string) {
+	if err := checkForward(name, ip.IP); err != nil {
+		a.Lock()
+		showError(a.uiError, err)
+		a.render()
+		a.Unlock()
+		return
+	}
+
+	op, err := client.IPUpdate(ip.ID, gandi.IPUpdateSpec{Reverse: name})
+	a.track(client, ip.IP, op, err, nil)
+}
@@ -0,0 +1,202 @@
+// Copyright 2017, Carlo Strub <cs@carlostrub.ch>
+// BSD 3-Clause License, see LICENSE file for details.
+
+package main
+
+import (
+	"context"
+	"strconv"
+	"sync"
+	"time"
+
+	"cost.li/bapu/gandi"
+	"github.com/gizak/termui"
+)
+
+// maxOperations is the number of operations kept in the operations panel.
+// Unfinished operations are kept regardless, so that their then is called.
+const maxOperations = 5
+
+// evtOperations is the path of the custom event posted after polling the
+// tracked operations.
+const evtOperations = "/usr/operations"
+
+// operationPoll is the outcome of polling the tracked operations.
+type operationPoll struct {
+	Finished bool // at least one operation reached a final step
+	Err      error
+	Source   *operationTracker
+}
+
+// trackedOperation is an operation launched from the UI together with a
+// description of what it acts on.
+type trackedOperation struct {
+	gandi.OperationReturn
+	Label string
+	then  func(op gandi.OperationReturn)
+}
+
+// operationTracker follows the operations launched from the UI until they
+// reached a final step.
+type operationTracker struct {
+	sync.Mutex
+	client *gandi.Client
+	ops    []trackedOperation
+}
+
+// Add starts tracking op, labelled with what it acts on.
+func (t *operationTracker) Add(label string, op gandi.OperationReturn) {
+	t.AddThen(label, op, nil)
+}
+
+// AddThen starts tracking op like Add. Once op reached a final step, then is
+// called with it from the polling goroutine, so that further operations
+// depending on op can be launched.
+func (t *operationTracker) AddThen(label string, op gandi.OperationReturn, then func(op gandi.OperationReturn)) {
+	t.Lock()
+	defer t.Unlock()
+
+	t.ops = append(t.ops, trackedOperation{
+		OperationReturn: op,
+		Label:           label,
+		then:            then,
+	})
+	t.trim()
+}
+
+// trim drops the oldest finished operations beyond maxOperations. The caller
+// must hold the lock.
+func (t *operationTracker) trim() {
+	excess := len(t.ops) - maxOperations
+	kept := t.ops[:0]
+	for _, op := range t.ops {
+		if excess > 0 && op.Finished() {
+			excess--
+			continue
+		}
+		kept = append(kept, op)
+	}
+	t.ops = kept
+}
+
+// Poll updates all unfinished operations via operation.info. It reports
+// whether any operation reached a final step and returns the first error
+// encountered, but keeps polling the remaining operations.
+func (t *operationTracker) Poll() (finished bool, err error) {
+	t.Lock()
+	var ids []int
+	for _, op := range t.ops {
+		if !op.Finished() {
+			ids = append(ids, op.ID)
+		}
+	}
+	t.Unlock()
+
+	for _, id := range ids {
+		info, infoErr := t.client.OperationInfo(id)
+		if infoErr != nil {
+			if err == nil {
+				err = infoErr
+			}
+			continue
+		}
+
+		var then func(op gandi.OperationReturn)
+		t.Lock()
+		for i := range t.ops {
+			if t.ops[i].ID == id {
+				t.ops[i].OperationReturn = info
+				if info.Finished() {
+					then, t.ops[i].then = t.ops[i].then, nil
+				}
+			}
+		}
+		t.trim()
+		t.Unlock()
+
+		if info.Finished() {
+			finished = true
+			if then != nil {
+				then(info)
+			}
+		}
+	}
+
+	return finished, err
+}
+
+// Run polls the tracked operations every interval until ctx is cancelled
+// and posts the outcome to the UI as evtOperations.
+func (t *operationTracker) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		if !t.pending() {
+			continue
+		}
+
+		finished, err := t.Poll()
+		termui.SendCustomEvt(evtOperations, operationPoll{
+			Finished: finished,
+			Err:      err,
+			Source:   t,
+		})
+	}
+}
+
+// pending reports whether any tracked operation is unfinished.
+func (t *operationTracker) pending() bool {
+	t.Lock()
+	defer t.Unlock()
+
+	for _, op := range t.ops {
+		if !op.Finished() {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Rows returns one line per tracked operation for the operations panel, the
+// most recent first. As unfinished operations are kept beyond
+// maxOperations, the older ones which do not fit the panel are summed up in
+// the last line.
+func (t *operationTracker) Rows() (rows []string) {
+	t.Lock()
+	defer t.Unlock()
+
+	for i := len(t.ops) - 1; i >= 0; i-- {
+		op := t.ops[i]
+
+		if len(rows) == maxOperations-1 && i > 0 {
+			rows = append(rows, "+"+strconv.Itoa(i+1)+" more")
+			break
+		}
+
+		row := "#" + strconv.Itoa(op.ID) + "  " + op.Label + "  " + op.Type +
+			"  [" + op.Step + "]" +
+			"  created " + op.DateCreated.Format("15:04:05") +
+			"  updated " + op.DateUpdated.Format("15:04:05")
+
+		switch op.Step {
+		case gandi.StepDone:
+			row += "  succeeded"
+		case gandi.StepError:
+			row += "  failed: " + op.LastError
+		case gandi.StepCancel:
+			row += "  cancelled"
+		}
+
+		rows = append(rows, row)
+	}
+
+	return rows
+}
@@ -0,0 +1,192 @@
+// Copyright 2017, Carlo Strub <cs@carlostrub.ch>
+// BSD 3-Clause License, see LICENSE file for details.
+
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"reflect"
+	"strings"
+	"text/template"
+	"time"
+
+	"gopkg.in/yaml.v2"
+)
+
+// Formats of --output
+var outputFormats = []string{"table", "json", "yaml", "csv", "template"}
+
+var timeType = reflect.TypeOf(time.Time{})
+
+// checkOutput validates the output options. A template without format
+// implies the template format.
+func checkOutput(opts *cliOptions) error {
+	if opts.Output == "" && opts.Template != "" {
+		opts.Output = "template"
+	}
+	if opts.Output == "" {
+		opts.Output = "table"
+	}
+
+	valid := false
+	for _, format := range outputFormats {
+		if opts.Output == format {
+			valid = true
+		}
+	}
+	switch {
+	case !valid:
+		return fmt.Errorf("unknown output format %s, use one of %s", opts.Output, strings.Join(outputFormats, ", "))
+	case opts.Output == "template" && opts.Template == "":
+		return fmt.Errorf("output format template needs --template")
+	case opts.Output != "template" && opts.Template != "":
+		return fmt.Errorf("--template only applies to output format template")
+	}
+
+	return nil
+}
+
+// xmlrpcFields returns the indices and names of the fields of the struct
+// type t which have an xmlrpc name, in the order they are declared.
+func xmlrpcFields(t reflect.Type) (indices []int, names []string) {
+	for i := 0; i < t.NumField(); i++ {
+		name := strings.Split(t.Field(i).Tag.Get("xmlrpc"), ",")[0]
+		if name != "" && name != "-" {
+			indices = append(indices, i)
+			names = append(names, name)
+		}
+	}
+
+	return indices, names
+}
+
+// record converts v, a value of the types of the gandi package, into maps
+// keyed by the names the API uses for the fields, which are stable unlike
+// the names in Go. Times are formatted according to RFC 3339; unset times
+// become nil.
+func record(v reflect.Value) interface{} {
+	switch {
+	case v.Type() == timeType:
+		t := v.Interface().(time.Time)
+		if t.IsZero() {
+			return nil
+		}
+		return t.Format(time.RFC3339)
+	case v.Kind() == reflect.Struct:
+		m := make(map[string]interface{})
+		indices, names := xmlrpcFields(v.Type())
+		for i, index := range indices {
+			m[names[i]] = record(v.Field(index))
+		}
+		return m
+	case v.Kind() == reflect.Slice:
+		list := make([]interface{}, v.Len())
+		for i := range list {
+			list[i] = record(v.Index(i))
+		}
+		return list
+	}
+
+	return v.Interface()
+}
+
+// items returns the elements of data if it is a slice, otherwise data
+// itself.
+func items(data interface{}) []reflect.Value {
+	v := reflect.ValueOf(data)
+	if v.Kind() != reflect.Slice {
+		return []reflect.Value{v}
+	}
+
+	list := make([]reflect.Value, v.Len())
+	for i := range list {
+		list[i] = v.Index(i)
+	}
+
+	return list
+}
+
+// writeCSV writes data, a struct or a slice of structs, to w with a header
+// naming the fields. Nested values are written as JSON.
+func writeCSV(w io.Writer, data interface{}) error {
+	list := items(data)
+	t := reflect.TypeOf(data)
+	if t.Kind() == reflect.Slice {
+		t = t.Elem()
+	}
+	indices, names := xmlrpcFields(t)
+
+	out := csv.NewWriter(w)
+	out.Write(names)
+	for _, v := range list {
+		row := make([]string, len(indices))
+		for i, index := range indices {
+			switch value := record(v.Field(index)).(type) {
+			case nil:
+			case map[string]interface{}, []interface{}:
+				b, err := json.Marshal(value)
+				if err != nil {
+					return err
+				}
+				row[i] = string(b)
+			default:
+				row[i] = fmt.Sprint(value)
+			}
+		}
+		out.Write(row)
+	}
+	out.Flush()
+
+	return out.Error()
+}
+
+// writeTemplate executes text for each element of data if it is a slice,
+// otherwise for data itself. Like the other formats, the template sees the
+// elements as converted by record. Every execution ends with a newline.
+func writeTemplate(w io.Writer, text string, data interface{}) error {
+	tmpl, err := template.New("output").Option("missingkey=error").Parse(text)
+	if err != nil {
+		return err
+	}
+
+	for _, v := range items(data) {
+		err = tmpl.Execute(w, record(v))
+		if err != nil {
+			return err
+		}
+		fmt.Fprintln(w)
+	}
+
+	return nil
+}
+
+// printListing writes data, a struct or a slice of structs of the gandi
+// package, to w in the format chosen by opts. The table format shows table
+// instead.
+func printListing(w io.Writer, opts cliOptions, data interface{}, table [][]string) error {
+	switch opts.Output {
+	case "json":
+		b, err := json.MarshalIndent(record(reflect.ValueOf(data)), "", "  ")
+		if err != nil {
+			return err
+		}
+		_, err = fmt.Fprintf(w, "%s\n", b)
+		return err
+	case "yaml":
+		b, err := yaml.Marshal(record(reflect.ValueOf(data)))
+		if err != nil {
+			return err
+		}
+		_, err = w.Write(b)
+		return err
+	case "csv":
+		return writeCSV(w, data)
+	case "template":
+		return writeTemplate(w, opts.Template, data)
+	}
+
+	return printTable(w, table)
+}
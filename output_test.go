@@ -0,0 +1,124 @@
+// Copyright 2017, Carlo Strub <cs@carlostrub.ch>
+// BSD 3-Clause License, see LICENSE file for details.
+
+package main
+
+import (
+	"bytes"
+	"flag"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"cost.li/bapu/gandi"
+)
+
+var update = flag.Bool("update", false, "rewrite the golden files in testdata")
+
+// sampleVMs returns a running virtual machine with a boot disk and a
+// public interface, as listed by hosting.vm.info.
+func sampleVMs() []gandi.VMReturn {
+	created := time.Date(2017, 6, 1, 12, 0, 0, 0, time.UTC)
+	updated := time.Date(2017, 6, 2, 8, 30, 0, 0, time.UTC)
+
+	return []gandi.VMReturn{{
+		Cores:        2,
+		DatacenterID: 1,
+		DateCreated:  created,
+		DateUpdated:  updated,
+		Description:  "web, \"front\"",
+		Disks: []gandi.DiskReturn{{
+			CanSnapshot:   true,
+			DatacenterID:  1,
+			DateCreated:   created,
+			ID:            2001,
+			IsBootDisk:    true,
+			KernelVersion: "3.12-x86_64 (hvm)",
+			Name:          "sys_web1",
+			Size:          10240,
+			SnapshotsID:   []int{2002},
+			State:         "created",
+			TotalSize:     10240,
+			Type:          "data",
+			Visibility:    "private",
+			VMsID:         []int{1001},
+		}},
+		Hostname: "web1",
+		ID:       1001,
+		Ifaces: []gandi.IfaceReturn{{
+			Bandwidth:    102400,
+			DatacenterID: 1,
+			DateCreated:  created,
+			ID:           3001,
+			IPs: []gandi.IPReturn{{
+				DatacenterID: 1,
+				DateCreated:  created,
+				ID:           4001,
+				IfaceID:      3001,
+				IP:           "192.0.2.10",
+				Reverse:      "web1.example.net",
+				State:        "created",
+				Version:      4,
+			}},
+			State: "used",
+			Type:  "public",
+			VMID:  1001,
+		}},
+		Memory:      2048,
+		State:       "running",
+		VMmaxMemory: 4096,
+	}}
+}
+
+// golden compares got with the file name in testdata, or rewrites the file
+// with -update.
+func golden(t *testing.T, name string, got []byte) {
+	path := filepath.Join("testdata", name)
+	if *update {
+		if err := ioutil.WriteFile(path, got, 0644); err != nil {
+			t.Fatal(err)
+		}
+		return
+	}
+
+	want, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, want) {
+		t.Errorf("output differs from %s:\n%s", path, got)
+	}
+}
+
+func TestPrintListing(t *testing.T) {
+	for _, c := range []struct {
+		opts   cliOptions
+		golden string
+	}{
+		{cliOptions{Output: "csv"}, "vm.csv"},
+		{cliOptions{Output: "json"}, "vm.json"},
+		{cliOptions{Output: "yaml"}, "vm.yaml"},
+		{
+			cliOptions{
+				Output:   "template",
+				Template: `{{.hostname}} {{.state}} {{range .ifaces}}{{range .ips}}{{.ip}} {{end}}{{end}}created {{.date_created}}`,
+			},
+			"vm.template",
+		},
+	} {
+		var out bytes.Buffer
+		if err := printListing(&out, c.opts, sampleVMs(), nil); err != nil {
+			t.Errorf("%s: %v", c.opts.Output, err)
+			continue
+		}
+		golden(t, c.golden, out.Bytes())
+	}
+}
+
+func TestTemplateMissingKey(t *testing.T) {
+	opts := cliOptions{Output: "template", Template: "{{.Hostname}}"}
+	if err := printListing(ioutil.Discard, opts, sampleVMs(), nil); err == nil {
+		t.Error("template with a Go field name accepted, want the names of the API only")
+	}
+}
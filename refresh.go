@@ -0,0 +1,197 @@
+// Copyright 2017, Carlo Strub <cs@carlostrub.ch>
+// BSD 3-Clause License, see LICENSE file for details.
+
+package main
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"time"
+
+	"cost.li/bapu/gandi"
+	"github.com/gizak/termui"
+)
+
+// Paths of the custom events posted by the refresher
+const (
+	evtRefreshStart = "/usr/refresh/start"
+	evtRefreshDone  = "/usr/refresh/done"
+)
+
+// Resources fetched by the refresher, in the order they are fetched
+const (
+	resAccount     = "account"
+	resVMCount     = "virtual machine count"
+	resVMs         = "virtual machines"
+	resDisks       = "disks"
+	resIfaces      = "network interfaces"
+	resIPs         = "IP addresses"
+	resVLANs       = "VLANs"
+	resKeys        = "SSH keys"
+	resDatacenters = "datacenters"
+)
+
+// snapshot is the state of the account as fetched by the refresher.
+type snapshot struct {
+	Info        gandi.AccountReturn
+	VMCount     int
+	VMs         []gandi.VMReturn
+	Disks       []gandi.DiskReturn
+	Ifaces      []gandi.IfaceReturn
+	IPs         []gandi.IPReturn
+	VLANs       []gandi.VLANReturn
+	Keys        []gandi.SSHKeyReturn
+	Datacenters []gandi.DatacenterReturn
+	Failed      []string         // resources which could not be fetched
+	Errs        map[string]error // why the resources in Failed could not be fetched
+	Err         error            // the refresh as a whole failed
+	Time        time.Time
+	Source      *refresher
+}
+
+// Fetched reports whether resource was fetched, so that its previous state
+// can be kept otherwise.
+func (s snapshot) Fetched(resource string) bool {
+	return s.Err == nil && s.Errs[resource] == nil
+}
+
+// Error returns an error describing why the refresh failed, or nil if all
+// resources were fetched.
+func (s snapshot) Error() error {
+	if s.Err != nil || len(s.Failed) == 0 {
+		return s.Err
+	}
+
+	msgs := make([]string, len(s.Failed))
+	for i, resource := range s.Failed {
+		msgs[i] = resource + ": " + s.Errs[resource].Error()
+	}
+
+	return errors.New("refreshing " + strings.Join(msgs, "; "))
+}
+
+// refresher fetches a snapshot of the account in the background and posts
+// it to the UI, so that a slow API never blocks the event loop.
+type refresher struct {
+	client      *gandi.Client
+	datacenters *datacenterCache
+	interval    time.Duration
+	timeout     time.Duration
+	trigger     chan struct{}
+	fetching    chan struct{} // holds a token while a fetch runs
+}
+
+// newRefresher returns a refresher fetching a snapshot every interval, giving
+// up on a single refresh after timeout. Datacenters are taken from
+// datacenters.
+func newRefresher(client *gandi.Client, datacenters *datacenterCache, interval, timeout time.Duration) *refresher {
+	return &refresher{
+		client:      client,
+		datacenters: datacenters,
+		interval:    interval,
+		timeout:     timeout,
+		trigger:     make(chan struct{}, 1),
+		fetching:    make(chan struct{}, 1),
+	}
+}
+
+// Run refreshes until ctx is cancelled. The first refresh happens right away.
+func (r *refresher) Run(ctx context.Context) {
+	ticker := time.NewTicker(r.interval)
+	defer ticker.Stop()
+
+	for {
+		r.refresh(ctx)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		case <-r.trigger:
+		}
+	}
+}
+
+// Trigger asks for a refresh without waiting for the next interval.
+func (r *refresher) Trigger() {
+	select {
+	case r.trigger <- struct{}{}:
+	default:
+		// A refresh is already pending
+	}
+}
+
+// refresh fetches a single snapshot and posts it as evtRefreshDone. While
+// a fetch abandoned by a previous refresh still runs, no other is started,
+// so that a slow API is not asked ever more.
+func (r *refresher) refresh(ctx context.Context) {
+	select {
+	case r.fetching <- struct{}{}:
+	default:
+		return
+	}
+	termui.SendCustomEvt(evtRefreshStart, nil)
+
+	ctx, cancel := context.WithTimeout(ctx, r.timeout)
+	defer cancel()
+
+	// The XML-RPC client cannot be cancelled, so the fetch runs on its own
+	// and is abandoned if it takes too long.
+	result := make(chan snapshot, 1)
+	go func() {
+		result <- fetchSnapshot(r.client, r.datacenters)
+		<-r.fetching
+	}()
+
+	var s snapshot
+	select {
+	case s = <-result:
+	case <-ctx.Done():
+		if ctx.Err() == context.DeadlineExceeded {
+			s.Err = errors.New("refreshing timed out after " + r.timeout.String())
+		} else {
+			return
+		}
+	}
+
+	s.Time = time.Now()
+	s.Source = r
+	termui.SendCustomEvt(evtRefreshDone, s)
+}
+
+// fetchSnapshot fetches the account information, its virtual machines,
+// disks, network interfaces, IP addresses, private VLANs and SSH keys, along
+// with the datacenters they are in. A resource which cannot be fetched is
+// recorded as failed, while the others are still fetched.
+func fetchSnapshot(client *gandi.Client, datacenters *datacenterCache) (s snapshot) {
+	s.Errs = make(map[string]error)
+	fetch := func(resource string, err error) {
+		if err != nil {
+			s.Failed = append(s.Failed, resource)
+			s.Errs[resource] = err
+		}
+	}
+
+	var err error
+	s.Info, err = client.AccountInfo()
+	fetch(resAccount, err)
+	s.VMCount, err = client.VMCount()
+	fetch(resVMCount, err)
+	s.VMs, err = client.VMList()
+	fetch(resVMs, err)
+	s.Disks, err = client.DiskList()
+	fetch(resDisks, err)
+	s.Ifaces, err = client.IfaceList()
+	fetch(resIfaces, err)
+	s.IPs, err = client.IPList()
+	fetch(resIPs, err)
+	s.VLANs, err = client.VLANList()
+	fetch(resVLANs, err)
+	s.Keys, err = client.SSHKeyList()
+	fetch(resKeys, err)
+	s.Datacenters, err = datacenters.List()
+	fetch(resDatacenters, err)
+
+	return s
+}
@@ -0,0 +1,142 @@
+// Copyright 2017, Carlo Strub <cs@carlostrub.ch>
+// BSD 3-Clause License, see LICENSE file for details.
+
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"cost.li/bapu/gandi"
+	"github.com/spf13/viper"
+)
+
+// hourlyCost estimates the credits per hour a virtual machine with the
+// given cores and memory costs, according to the [rates] section of the
+// configuration. Gandi does not publish its rates through the API, so
+// without that section there is no estimate and ok is false.
+func hourlyCost(cores, memory int) (cost float64, ok bool) {
+	if !viper.IsSet("rates.core") && !viper.IsSet("rates.memory") {
+		return 0, false
+	}
+
+	return float64(cores)*viper.GetFloat64("rates.core") +
+		float64(memory)/1024*viper.GetFloat64("rates.memory"), true
+}
+
+// resizeVM asks for the new cores and memory of the selected virtual
+// machine and changes them via hosting.vm.update. Changes which cannot be
+// made while the machine runs are made after stopping it, and the machine
+// is started again afterwards.
+func (a *app) resizeVM() {
+	a.Lock()
+	if len(a.list) == 0 {
+		a.Unlock()
+		return
+	}
+	client := a.client
+	id := a.list[a.selector].ID
+	a.Unlock()
+
+	vm, err := client.VMInfo(id)
+
+	a.Lock()
+	defer a.Unlock()
+
+	if err == nil {
+		switch vm.State {
+		case "halted", "running":
+		default:
+			err = fmt.Errorf("%s is %s and cannot be resized", vm.Hostname, vm.State)
+		}
+	}
+	showError(a.uiError, err)
+	if err != nil || client != a.client {
+		a.render()
+		return
+	}
+
+	var spec gandi.VMUpdateSpec
+
+	a.dialog = newWizard(
+		func(next func()) dialog {
+			return newPrompt("Resize "+vm.Hostname, "Cores", strconv.Itoa(vm.Cores), intValidator(1), func(input string) {
+				spec.Cores, _ = strconv.Atoi(strings.TrimSpace(input))
+				next()
+			})
+		},
+		func(next func()) dialog {
+			label := fmt.Sprintf("Memory in MB (max %dMB without reboot)", vm.VMmaxMemory)
+			return newPrompt("Resize "+vm.Hostname, label, strconv.Itoa(vm.Memory), intValidator(256), func(input string) {
+				spec.Memory, _ = strconv.Atoi(strings.TrimSpace(input))
+				next()
+			})
+		},
+		func(next func()) dialog {
+			// Beyond vm_max_memory, the limit itself has to be raised
+			if spec.Memory > vm.VMmaxMemory {
+				spec.VMmaxMemory = spec.Memory
+			}
+			hot := spec.Cores >= vm.Cores && spec.Memory >= vm.Memory && spec.VMmaxMemory == 0
+			reboot := vm.State == "running" && !hot
+
+			lines := []string{
+				fmt.Sprintf("Cores:   %d -> %d", vm.Cores, spec.Cores),
+				fmt.Sprintf("Memory:  %dMB -> %dMB", vm.Memory, spec.Memory),
+			}
+			before, ok := hourlyCost(vm.Cores, vm.Memory)
+			if ok {
+				after, _ := hourlyCost(spec.Cores, spec.Memory)
+				lines = append(lines, fmt.Sprintf("Cost:    %+.2f credits per hour (estimated from [rates])", after-before))
+			}
+			if spec.VMmaxMemory != 0 {
+				lines = append(lines, fmt.Sprintf("The memory limit is raised from %dMB to %dMB.", vm.VMmaxMemory, spec.VMmaxMemory))
+			}
+			lines = append(lines, "")
+			switch {
+			case reboot:
+				lines = append(lines, vm.Hostname+" needs a reboot: it will be stopped, resized and started again.")
+			case vm.State == "running":
+				lines = append(lines, "The change is applied while "+vm.Hostname+" keeps running.")
+			default:
+				lines = append(lines, "The change is applied while "+vm.Hostname+" is halted.")
+			}
+
+			return newConfirmation("Resize "+vm.Hostname, lines, func() {
+				next()
+				// Called from handleKey with the lock held
+				if reboot {
+					go a.stopThenUpdate(client, vm, spec)
+				} else {
+					go a.updateVM(client, vm, spec, false)
+				}
+			})
+		},
+	)
+	a.render()
+}
+
+// stopThenUpdate stops vm, applies spec once it is halted and starts it
+// again.
+func (a *app) stopThenUpdate(client *gandi.Client, vm gandi.VMReturn, spec gandi.VMUpdateSpec) {
+	op, err := client.VMStop(vm.ID)
+	a.track(client, vm.Hostname, op, err, func(op gandi.OperationReturn) {
+		if op.Step == gandi.StepDone {
+			a.updateVM(client, vm, spec, true)
+		}
+	})
+}
+
+// updateVM calls hosting.vm.update on vm and, if restart is set, starts it
+// once the update is finished.
+func (a *app) updateVM(client *gandi.Client, vm gandi.VMReturn, spec gandi.VMUpdateSpec, restart bool) {
+	op, err := client.VMUpdate(vm.ID, spec)
+	a.track(client, vm.Hostname, op, err, func(gandi.OperationReturn) {
+		if restart {
+			// Start the machine again even if the update failed
+			op, err := client.VMStart(vm.ID)
+			a.track(client, vm.Hostname, op, err, nil)
+		}
+	})
+}
@@ -0,0 +1,217 @@
+// Copyright 2017, Carlo Strub <cs@carlostrub.ch>
+// BSD 3-Clause License, see LICENSE file for details.
+
+package main
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"cost.li/bapu/gandi"
+)
+
+// snapshotsOf returns the snapshots taken of disk among disks.
+func snapshotsOf(disk gandi.DiskReturn, disks []gandi.DiskReturn) (snapshots []gandi.DiskReturn) {
+	for _, d := range disks {
+		if d.Type == "snapshot" && d.Source == disk.ID {
+			snapshots = append(snapshots, d)
+		}
+	}
+
+	return snapshots
+}
+
+// profileSummary describes the schedules of a snapshot profile in a line,
+// such as "daily 7, weekly 2".
+func profileSummary(profile gandi.SnapshotProfileReturn) string {
+	var schedules []string
+	for _, schedule := range profile.Schedules {
+		schedules = append(schedules, fmt.Sprintf("%s %d", schedule.Name, schedule.KeptVersion))
+	}
+
+	return strings.Join(schedules, ", ")
+}
+
+// snapshotMenu offers to take a snapshot of the selected disk, to list its
+// snapshots, to roll it back to one of them or to change its snapshot
+// profile.
+func (a *app) snapshotMenu() {
+	a.Lock()
+	defer a.Unlock()
+
+	disk, ok := a.selectedDisk()
+	if !ok {
+		return
+	}
+	if disk.Type == "snapshot" {
+		showError(a.uiError, fmt.Errorf("%s is a snapshot itself, select %s to manage its snapshots", disk.Name, diskName(a.disks, disk.Source)))
+		a.render()
+		return
+	}
+	if !disk.CanSnapshot {
+		showError(a.uiError, fmt.Errorf("%s cannot be snapshotted", disk.Name))
+		a.render()
+		return
+	}
+
+	profile := "none"
+	if disk.SnapshotProfile.ID != 0 {
+		profile = disk.SnapshotProfile.Name
+	}
+	items := []string{
+		"Take a snapshot now",
+		fmt.Sprintf("List snapshots (%d taken)", len(snapshotsOf(disk, a.disks))),
+		fmt.Sprintf("Roll back to a snapshot (%d taken)", len(snapshotsOf(disk, a.disks))),
+		"Change snapshot profile (now " + profile + ")",
+	}
+
+	a.dialog = newChooser("Snapshots of "+disk.Name, items, func(i int) {
+		// Called from handleKey with the lock held
+		switch i {
+		case 0:
+			a.takeSnapshot(disk)
+		case 1:
+			a.listSnapshots(disk)
+		case 2:
+			a.chooseSnapshot(disk)
+		case 3:
+			go a.chooseSnapshotProfile(disk)
+		}
+	})
+	a.render()
+}
+
+// takeSnapshot asks for the name of a new snapshot of disk and takes it via
+// hosting.disk.create_from. The caller must hold the lock.
+func (a *app) takeSnapshot(disk gandi.DiskReturn) {
+	client := a.client
+
+	// Shorten the disk name rather than the time it is told apart by
+	suffix := "_" + time.Now().Format("20060102_1504")
+	name := disk.Name
+	if len(name)+len(suffix) > 63 {
+		name = name[:63-len(suffix)]
+	}
+	name += suffix
+
+	a.dialog = newPrompt("Snapshot of "+disk.Name, "Name", name, validateDiskName, func(input string) {
+		spec := gandi.DiskCreateSpec{
+			DatacenterID: disk.DatacenterID,
+			Name:         input,
+			Type:         "snapshot",
+		}
+		go func() {
+			op, err := client.DiskCreateFrom(spec, disk.ID)
+			a.track(client, input, op, err, nil)
+		}()
+	})
+}
+
+// listSnapshots shows when the snapshots of disk were taken and their size.
+// The caller must hold the lock.
+func (a *app) listSnapshots(disk gandi.DiskReturn) {
+	snapshots := snapshotsOf(disk, a.disks)
+	if len(snapshots) == 0 {
+		showError(a.uiError, fmt.Errorf("no snapshot of %s taken yet", disk.Name))
+		return
+	}
+
+	var lines []string
+	for _, snapshot := range snapshots {
+		lines = append(lines, fmt.Sprintf("%s  taken %s  %dMB  %s", snapshot.Name, snapshot.DateCreated.Format(dateFormat), snapshot.Size, snapshot.State))
+	}
+
+	a.dialog = newViewer("Snapshots of "+disk.Name, lines)
+}
+
+// chooseSnapshot offers the snapshots of disk and rolls disk back to the
+// chosen one after confirmation. The caller must hold the lock.
+func (a *app) chooseSnapshot(disk gandi.DiskReturn) {
+	snapshots := snapshotsOf(disk, a.disks)
+	if len(snapshots) == 0 {
+		showError(a.uiError, fmt.Errorf("no snapshot of %s taken yet", disk.Name))
+		return
+	}
+
+	var names []string
+	for _, snapshot := range snapshots {
+		names = append(names, fmt.Sprintf("%s  taken %s  %s", snapshot.Name, snapshot.DateCreated.Format(dateFormat), snapshot.State))
+	}
+
+	client := a.client
+	a.dialog = newWizard(
+		func(next func()) dialog {
+			c := newChooser("Roll back "+disk.Name+" to", names, func(i int) {
+				snapshots = snapshots[i : i+1]
+				next()
+			})
+			// The latest snapshot is the most likely choice
+			c.Select(len(names) - 1)
+			return c
+		},
+		func(next func()) dialog {
+			snapshot := snapshots[0]
+			lines := []string{
+				fmt.Sprintf("%s is restored to its state of %s (%s).", disk.Name, snapshot.DateCreated.Format(dateFormat), snapshot.Name),
+				"Everything written to it since is lost.",
+			}
+			for _, id := range disk.VMsID {
+				for _, vm := range a.vms {
+					if vm.ID == id && vm.State != "halted" {
+						lines = append(lines, "", vm.Hostname+" is "+vm.State+", stop it before rolling back.")
+					}
+				}
+			}
+			return newConfirmation("Roll back "+disk.Name, lines, func() {
+				next()
+				// Called from handleKey with the lock held
+				go func() {
+					op, err := client.DiskRollbackFrom(snapshot.ID)
+					a.track(client, disk.Name, op, err, nil)
+				}()
+			})
+		},
+	)
+}
+
+// chooseSnapshotProfile offers the snapshot profiles and applies the chosen
+// one to disk.
+func (a *app) chooseSnapshotProfile(disk gandi.DiskReturn) {
+	a.Lock()
+	client := a.client
+	a.Unlock()
+
+	profiles, err := client.SnapshotProfileList()
+
+	a.Lock()
+	defer a.Unlock()
+
+	showError(a.uiError, err)
+	if err != nil || client != a.client {
+		a.render()
+		return
+	}
+
+	var names []string
+	current := 0
+	for i, profile := range profiles {
+		names = append(names, fmt.Sprintf("%s: %s (%d kept, quota x%.1f)", profile.Name, profileSummary(profile), profile.KeptTotal, profile.QuotaFactor))
+		if profile.ID == disk.SnapshotProfile.ID {
+			current = i
+		}
+	}
+
+	c := newChooser("Snapshot profile of "+disk.Name, names, func(i int) {
+		if profiles[i].ID == disk.SnapshotProfile.ID {
+			return
+		}
+		go func() {
+			op, err := client.DiskUpdate(disk.ID, gandi.DiskUpdateSpec{SnapshotProfile: profiles[i].ID})
+			a.track(client, disk.Name, op, err, nil)
+		}()
+	})
+	c.Select(current)
+	a.dialog = c
+	a.render()
+}
@@ -0,0 +1,114 @@
+// Copyright 2017, Carlo Strub <cs@carlostrub.ch>
+// BSD 3-Clause License, see LICENSE file for details.
+
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"os/exec"
+
+	"cost.li/bapu/gandi"
+	"github.com/spf13/viper"
+)
+
+// primaryIP returns the address ssh connects to for the virtual machine with
+// the given id: an IPv4 address of its first public interface, or else an
+// IPv6 one. It is empty if the machine has no public address.
+func primaryIP(vmID int, ifaces []gandi.IfaceReturn, ips []gandi.IPReturn) string {
+	var primary *gandi.IfaceReturn
+	for i, iface := range ifaces {
+		if iface.VMID != vmID || iface.Type == "private" {
+			continue
+		}
+		if primary == nil || iface.Num < primary.Num {
+			primary = &ifaces[i]
+		}
+	}
+	if primary == nil {
+		return ""
+	}
+
+	addr := ""
+	for _, ip := range ipsOf(primary.ID, ips) {
+		if ip.Version == 4 {
+			return ip.IP
+		}
+		if addr == "" {
+			addr = ip.IP
+		}
+	}
+
+	return addr
+}
+
+// sshArgs returns the command and arguments connecting to host as user, as
+// set up by the [ssh] section of the configuration. Without user, ssh picks
+// one itself.
+func sshArgs(user, host string) (string, []string) {
+	viper.SetDefault("ssh.command", "ssh")
+
+	target := host
+	if user != "" {
+		target = user + "@" + host
+	}
+
+	return viper.GetString("ssh.command"), append(viper.GetStringSlice("ssh.options"), target)
+}
+
+// runSSH runs ssh in the foreground until the session ends. If ssh fails,
+// its output is kept on screen until the user presses Enter.
+func runSSH(name string, args []string) error {
+	fmt.Printf("Connecting to %s, bapu resumes once the session ends.\n", args[len(args)-1])
+
+	cmd := exec.Command(name, args...)
+	cmd.Stdin = os.Stdin
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	err := cmd.Run()
+	if err != nil {
+		fmt.Printf("\n%s: %v\nPress Enter to return to bapu.", name, err)
+		bufio.NewReader(os.Stdin).ReadString('\n')
+	}
+
+	return err
+}
+
+// ssh connects to host as user. The terminal is handed over to ssh meanwhile
+// and the UI is restored afterwards, showing errors prefixed with label.
+func (a *app) ssh(label, user, host string) {
+	name, args := sshArgs(user, host)
+
+	a.suspend(label, func() error {
+		return runSSH(name, args)
+	})
+}
+
+// sshVM opens an SSH session to the selected virtual machine.
+func (a *app) sshVM() {
+	a.Lock()
+	if len(a.list) == 0 {
+		a.Unlock()
+		return
+	}
+	vm := a.list[a.selector]
+	addr := primaryIP(vm.ID, a.ifaces, a.ips)
+
+	var err error
+	switch {
+	case vm.State != "running":
+		err = fmt.Errorf("%s is %s, start it first", vm.Hostname, vm.State)
+	case addr == "":
+		err = fmt.Errorf("%s has no public IP address", vm.Hostname)
+	}
+	if err != nil {
+		showError(a.uiError, err)
+		a.render()
+		a.Unlock()
+		return
+	}
+	a.Unlock()
+
+	a.ssh("ssh to "+vm.Hostname, viper.GetString("ssh.user"), addr)
+}
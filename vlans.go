@@ -0,0 +1,483 @@
+// Copyright 2017, Carlo Strub <cs@carlostrub.ch>
+// BSD 3-Clause License, see LICENSE file for details.
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+
+	"cost.li/bapu/gandi"
+	"github.com/gizak/termui"
+)
+
+// defaultSubnet is offered for new private VLANs.
+const defaultSubnet = "192.168.0.0/24"
+
+// membersOf returns the network interfaces among ifaces in vlan.
+func membersOf(vlan gandi.VLANReturn, ifaces []gandi.IfaceReturn) (members []gandi.IfaceReturn) {
+	for _, iface := range ifaces {
+		if iface.VLAN.ID == vlan.ID {
+			members = append(members, iface)
+		}
+	}
+
+	return members
+}
+
+// parseSubnet parses an IPv4 network in CIDR notation.
+func parseSubnet(subnet string) (*net.IPNet, error) {
+	_, network, err := net.ParseCIDR(strings.TrimSpace(subnet))
+	if err != nil || network.IP.To4() == nil {
+		return nil, errors.New("not an IPv4 network such as " + defaultSubnet)
+	}
+
+	return network, nil
+}
+
+// broadcast returns the broadcast address of network.
+func broadcast(network *net.IPNet) net.IP {
+	addr := append(net.IP(nil), network.IP.To4()...)
+	mask := network.Mask[len(network.Mask)-net.IPv4len:]
+	for i := range addr {
+		addr[i] |= ^mask[i]
+	}
+
+	return addr
+}
+
+// validateSubnet accepts IPv4 networks in CIDR notation.
+func validateSubnet(input string) error {
+	_, err := parseSubnet(input)
+	return err
+}
+
+// hostValidator returns a validation function for prompts accepting host
+// addresses of subnet, that is neither its network nor its broadcast
+// address, other than the ones in taken. Point-to-point /31 and single
+// host /32 networks have neither, as in RFC 3021.
+func hostValidator(subnet string, taken []string) func(string) error {
+	return func(input string) error {
+		network, err := parseSubnet(subnet)
+		if err != nil {
+			return err
+		}
+		addr := net.ParseIP(strings.TrimSpace(input))
+		if addr == nil || addr.To4() == nil {
+			return errors.New("not an IPv4 address")
+		}
+		ones, bits := network.Mask.Size()
+		reserved := bits-ones > 1 && (addr.Equal(network.IP) || addr.Equal(broadcast(network)))
+		if !network.Contains(addr) || reserved {
+			return errors.New("not a host address of " + subnet)
+		}
+		for _, t := range taken {
+			if addr.String() == t {
+				return errors.New(t + " is taken")
+			}
+		}
+		return nil
+	}
+}
+
+// firstHost returns the first host address of subnet other than the ones
+// in taken, or an empty string if there is none.
+func firstHost(subnet string, taken []string) string {
+	network, err := parseSubnet(subnet)
+	if err != nil {
+		return ""
+	}
+
+	valid := hostValidator(subnet, taken)
+	for addr := append(net.IP(nil), network.IP.To4()...); network.Contains(addr); {
+		if valid(addr.String()) == nil {
+			return addr.String()
+		}
+		for i := len(addr) - 1; i >= 0; i-- {
+			addr[i]++
+			if addr[i] != 0 {
+				break
+			}
+		}
+	}
+
+	return ""
+}
+
+// vlanAddresses returns the gateway of vlan and the addresses bound to its
+// members among ips.
+func vlanAddresses(vlan gandi.VLANReturn, ifaces []gandi.IfaceReturn, ips []gandi.IPReturn) (taken []string) {
+	if vlan.Gateway != "" {
+		taken = append(taken, vlan.Gateway)
+	}
+	for _, iface := range membersOf(vlan, ifaces) {
+		for _, ip := range ipsOf(iface.ID, ips) {
+			taken = append(taken, ip.IP)
+		}
+	}
+
+	return taken
+}
+
+// vlanRows returns the rows of the VLAN table. If grouped is set, list is
+// sorted by datacenter and the datacenter is only named on the first row of
+// its group.
+func vlanRows(list []gandi.VLANReturn, selector int, ifaces []gandi.IfaceReturn, datacenters []gandi.DatacenterReturn, grouped bool) (vlans [][]string) {
+	vlans = append(vlans, []string{
+		"Selected",
+		"Name",
+		"Subnet",
+		"Gateway",
+		"Datacenter",
+		"Interfaces",
+		"State",
+	})
+
+	for i, val := range list {
+		s := ""
+		if selector == i {
+			s = "*"
+		}
+		dc := datacenterName(datacenters, val.DatacenterID)
+		if grouped && i > 0 && list[i-1].DatacenterID == val.DatacenterID {
+			dc = ""
+		}
+		gateway := val.Gateway
+		if gateway == "" {
+			gateway = "-"
+		}
+		vlans = append(vlans, []string{
+			s,
+			val.Name,
+			val.Subnet,
+			gateway,
+			dc,
+			strconv.Itoa(len(membersOf(val, ifaces))),
+			val.State,
+		})
+	}
+
+	return vlans
+}
+
+// colorVLANRows colors the rows of the VLAN table according to the state of
+// the respective VLAN.
+func colorVLANRows(table *termui.Table, list []gandi.VLANReturn) {
+	colorTable(table, len(list), func(i int) (bg, fg termui.Attribute, ok bool) {
+		switch list[i].State {
+		case "being_created", "deleting":
+			return termui.ColorWhite, termui.ColorBlack, true
+		}
+
+		return 0, 0, false
+	})
+}
+
+// selectedVLAN returns the selected VLAN of the VLAN tab. The caller must
+// hold the lock.
+func (a *app) selectedVLAN() (gandi.VLANReturn, bool) {
+	if len(a.vlanList) == 0 {
+		return gandi.VLANReturn{}, false
+	}
+
+	return a.vlanList[a.vlanSelector], true
+}
+
+// handleVLANKey processes the key presses of the VLAN tab.
+func (a *app) handleVLANKey(key string) {
+	switch key {
+	case "c":
+		a.createVLAN()
+	case "n":
+		a.renameVLAN()
+	case "w":
+		a.changeGateway()
+	case "d":
+		a.deleteVLAN()
+	case "i":
+		a.addPrivateIface()
+	case "<enter>":
+		a.showVLAN()
+	}
+}
+
+// showVLAN opens a dialog with the selected VLAN and its member interfaces.
+func (a *app) showVLAN() {
+	a.Lock()
+	defer a.Unlock()
+
+	vlan, ok := a.selectedVLAN()
+	if !ok {
+		return
+	}
+
+	gateway := vlan.Gateway
+	if gateway == "" {
+		gateway = "none"
+	}
+	lines := []string{
+		fmt.Sprintf("Name:         %s (ID %d)", vlan.Name, vlan.ID),
+		fmt.Sprintf("State:        %s", vlan.State),
+		fmt.Sprintf("Subnet:       %s", vlan.Subnet),
+		fmt.Sprintf("Gateway:      %s", gateway),
+		fmt.Sprintf("Datacenter:   %s", datacenterName(a.dcs, vlan.DatacenterID)),
+		"",
+		"Interfaces",
+	}
+
+	members := membersOf(vlan, a.ifaces)
+	if len(members) == 0 {
+		lines = append(lines, "  none")
+	}
+	for _, iface := range members {
+		vm := "not attached"
+		if iface.VMID != 0 {
+			vm = fmt.Sprintf("%s #%d", vmName(a.vms, iface.VMID), iface.Num)
+		}
+		var addrs []string
+		for _, ip := range ipsOf(iface.ID, a.ips) {
+			addrs = append(addrs, ip.IP)
+		}
+		lines = append(lines, fmt.Sprintf("  %-15s  %-20s  interface %d  %s", strings.Join(addrs, ", "), vm, iface.ID, iface.State))
+	}
+
+	a.dialog = newViewer("VLAN "+vlan.Name, lines)
+	a.render()
+}
+
+// createVLAN asks for the datacenter, name, subnet and gateway of a new
+// private VLAN and creates it via hosting.vlan.create.
+func (a *app) createVLAN() {
+	a.Lock()
+	client := a.client
+	cache := a.datacenters
+	a.Unlock()
+
+	datacenters, err := cache.List()
+
+	a.Lock()
+	defer a.Unlock()
+
+	showError(a.uiError, err)
+	if err != nil || client != a.client {
+		a.render()
+		return
+	}
+
+	var spec gandi.VLANCreateSpec
+	var dcName string
+
+	a.dialog = newWizard(
+		func(next func()) dialog {
+			var names []string
+			for _, dc := range datacenters {
+				names = append(names, datacenterName(datacenters, dc.ID))
+			}
+			return newChooser("Datacenter", names, func(i int) {
+				spec.DatacenterID = datacenters[i].ID
+				dcName = names[i]
+				next()
+			})
+		},
+		func(next func()) dialog {
+			return newPrompt("New VLAN", "Name", "", validateDiskName, func(input string) {
+				spec.Name = input
+				next()
+			})
+		},
+		func(next func()) dialog {
+			return newPrompt("New VLAN", "Subnet", defaultSubnet, validateSubnet, func(input string) {
+				network, _ := parseSubnet(input)
+				spec.Subnet = network.String()
+				next()
+			})
+		},
+		func(next func()) dialog {
+			validate := func(input string) error {
+				if strings.TrimSpace(input) == "" {
+					return nil
+				}
+				return hostValidator(spec.Subnet, nil)(input)
+			}
+			return newPrompt("New VLAN", "Gateway (empty for none)", firstHost(spec.Subnet, nil), validate, func(input string) {
+				spec.Gateway = strings.TrimSpace(input)
+				next()
+			})
+		},
+		func(next func()) dialog {
+			gateway := spec.Gateway
+			if gateway == "" {
+				gateway = "none"
+			}
+			return newConfirmation("Create VLAN "+spec.Name, []string{
+				"Name:        " + spec.Name,
+				"Datacenter:  " + dcName,
+				"Subnet:      " + spec.Subnet,
+				"Gateway:     " + gateway,
+			}, func() {
+				next()
+				// Called from handleKey with the lock held
+				go func() {
+					op, err := client.VLANCreate(spec)
+					a.track(client, "VLAN "+spec.Name, op, err, nil)
+				}()
+			})
+		},
+	)
+	a.render()
+}
+
+// renameVLAN asks for a new name of the selected VLAN.
+func (a *app) renameVLAN() {
+	a.Lock()
+	defer a.Unlock()
+
+	vlan, ok := a.selectedVLAN()
+	if !ok {
+		return
+	}
+	client := a.client
+
+	a.dialog = newPrompt("Rename VLAN "+vlan.Name, "New name", vlan.Name, validateDiskName, func(input string) {
+		if input == vlan.Name {
+			return
+		}
+		go func() {
+			op, err := client.VLANUpdate(vlan.ID, gandi.VLANUpdateSpec{Name: input})
+			a.track(client, "VLAN "+vlan.Name, op, err, nil)
+		}()
+	})
+	a.render()
+}
+
+// changeGateway asks for a new gateway of the selected VLAN.
+func (a *app) changeGateway() {
+	a.Lock()
+	defer a.Unlock()
+
+	vlan, ok := a.selectedVLAN()
+	if !ok {
+		return
+	}
+	client := a.client
+
+	var taken []string
+	for _, addr := range vlanAddresses(vlan, a.ifaces, a.ips) {
+		if addr != vlan.Gateway {
+			taken = append(taken, addr)
+		}
+	}
+
+	label := "Gateway in " + vlan.Subnet
+	a.dialog = newPrompt("Gateway of VLAN "+vlan.Name, label, vlan.Gateway, hostValidator(vlan.Subnet, taken), func(input string) {
+		input = strings.TrimSpace(input)
+		if input == vlan.Gateway {
+			return
+		}
+		go func() {
+			op, err := client.VLANUpdate(vlan.ID, gandi.VLANUpdateSpec{Gateway: input})
+			a.track(client, "VLAN "+vlan.Name, op, err, nil)
+		}()
+	})
+	a.render()
+}
+
+// deleteVLAN deletes the selected VLAN after confirmation. VLANs with
+// interfaces have to be emptied first.
+func (a *app) deleteVLAN() {
+	a.Lock()
+	defer a.Unlock()
+
+	vlan, ok := a.selectedVLAN()
+	if !ok {
+		return
+	}
+	if n := len(membersOf(vlan, a.ifaces)); n > 0 {
+		showError(a.uiError, fmt.Errorf("VLAN %s still has %d interfaces, release them first", vlan.Name, n))
+		a.render()
+		return
+	}
+	client := a.client
+
+	a.dialog = newConfirmation("Delete VLAN "+vlan.Name, []string{
+		fmt.Sprintf("VLAN %s (%s) is deleted.", vlan.Name, vlan.Subnet),
+	}, func() {
+		go func() {
+			op, err := client.VLANDelete(vlan.ID)
+			a.track(client, "VLAN "+vlan.Name, op, err, nil)
+		}()
+	})
+	a.render()
+}
+
+// addPrivateIface creates an interface with a chosen address in the
+// selected VLAN and attaches it to a virtual machine once it is created.
+func (a *app) addPrivateIface() {
+	a.Lock()
+	defer a.Unlock()
+
+	vlan, ok := a.selectedVLAN()
+	if !ok {
+		return
+	}
+
+	var candidates []gandi.VMReturn
+	var names []string
+	for _, vm := range a.vms {
+		if vm.State != "deleted" && vm.DatacenterID == vlan.DatacenterID {
+			candidates = append(candidates, vm)
+			names = append(names, vm.Hostname+" ("+vm.State+")")
+		}
+	}
+	if len(candidates) == 0 {
+		showError(a.uiError, fmt.Errorf("no virtual machine in %s to connect to VLAN %s", datacenterName(a.dcs, vlan.DatacenterID), vlan.Name))
+		a.render()
+		return
+	}
+
+	client := a.client
+	taken := vlanAddresses(vlan, a.ifaces, a.ips)
+	spec := gandi.IfaceCreateSpec{
+		DatacenterID: vlan.DatacenterID,
+		VLAN:         vlan.ID,
+	}
+	var vm gandi.VMReturn
+
+	a.dialog = newWizard(
+		func(next func()) dialog {
+			return newChooser("Connect to VLAN "+vlan.Name, names, func(i int) {
+				vm = candidates[i]
+				next()
+			})
+		},
+		func(next func()) dialog {
+			label := "Address in " + vlan.Subnet
+			return newPrompt("Interface of "+vm.Hostname, label, firstHost(vlan.Subnet, taken), hostValidator(vlan.Subnet, taken), func(input string) {
+				spec.IP = strings.TrimSpace(input)
+				next()
+			})
+		},
+		func(next func()) dialog {
+			return newConfirmation("Connect "+vm.Hostname, []string{
+				fmt.Sprintf("%s gets an interface in VLAN %s with address %s.", vm.Hostname, vlan.Name, spec.IP),
+				"The address has to be configured within " + vm.Hostname + " afterwards.",
+			}, func() {
+				next()
+				// Called from handleKey with the lock held
+				go func() {
+					op, err := client.IfaceCreate(spec)
+					a.track(client, vm.Hostname+" "+spec.IP, op, err, func(op gandi.OperationReturn) {
+						if op.Step == gandi.StepDone {
+							op, err := client.VMIfaceAttach(vm.ID, op.IfaceID)
+							a.track(client, vm.Hostname+" "+spec.IP, op, err, nil)
+						}
+					})
+				}()
+			})
+		},
+	)
+	a.render()
+}
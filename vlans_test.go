@@ -0,0 +1,100 @@
+// Copyright 2017, Carlo Strub <cs@carlostrub.ch>
+// BSD 3-Clause License, see LICENSE file for details.
+
+package main
+
+import "testing"
+
+func TestBroadcast(t *testing.T) {
+	for _, c := range []struct {
+		subnet string
+		want   string
+	}{
+		{"10.0.0.0/24", "10.0.0.255"},
+		{"10.0.0.0/8", "10.255.255.255"},
+		{"192.168.1.64/26", "192.168.1.127"},
+		{"192.168.1.10/31", "192.168.1.11"},
+		{"192.168.1.10/32", "192.168.1.10"},
+		// Host bits given are dropped
+		{"172.16.5.9/16", "172.16.255.255"},
+	} {
+		network, err := parseSubnet(c.subnet)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := broadcast(network).String(); got != c.want {
+			t.Errorf("broadcast(%s) = %s, want %s", c.subnet, got, c.want)
+		}
+	}
+}
+
+func TestHostValidator(t *testing.T) {
+	taken := []string{"10.0.0.1", "10.0.0.5"}
+
+	for _, c := range []struct {
+		subnet string
+		input  string
+		ok     bool
+	}{
+		{"10.0.0.0/24", "10.0.0.2", true},
+		{"10.0.0.0/24", " 10.0.0.254 ", true},
+		{"10.0.0.0/24", "10.0.0.0", false},
+		{"10.0.0.0/24", "10.0.0.255", false},
+		{"10.0.0.0/24", "10.0.0.1", false},
+		{"10.0.0.0/24", "10.0.0.5", false},
+		{"10.0.0.0/24", "10.0.1.2", false},
+		{"10.0.0.0/24", "fd00::2", false},
+		{"10.0.0.0/24", "not an address", false},
+		{"10.0.0.4/30", "10.0.0.6", true},
+		{"10.0.0.4/30", "10.0.0.4", false},
+		{"10.0.0.4/30", "10.0.0.7", false},
+
+		// Point-to-point and single host networks reserve no address
+		{"10.0.0.2/31", "10.0.0.2", true},
+		{"10.0.0.2/31", "10.0.0.3", true},
+		{"10.0.0.4/31", "10.0.0.5", false},
+		{"10.0.0.9/32", "10.0.0.9", true},
+		{"10.0.0.9/32", "10.0.0.10", false},
+		{"10.0.0.5/32", "10.0.0.5", false},
+
+		{"not a subnet", "10.0.0.2", false},
+	} {
+		err := hostValidator(c.subnet, taken)(c.input)
+		if c.ok && err != nil {
+			t.Errorf("%q in %s rejected: %v", c.input, c.subnet, err)
+		}
+		if !c.ok && err == nil {
+			t.Errorf("%q in %s accepted", c.input, c.subnet)
+		}
+	}
+}
+
+func TestFirstHost(t *testing.T) {
+	for _, c := range []struct {
+		subnet string
+		taken  []string
+		want   string
+	}{
+		{"10.0.0.0/24", nil, "10.0.0.1"},
+		{"10.0.0.0/24", []string{"10.0.0.1", "10.0.0.2"}, "10.0.0.3"},
+		{"10.0.0.0/24", []string{"10.0.0.2"}, "10.0.0.1"},
+		{"10.0.0.0/23", []string{"10.0.0.255"}, "10.0.0.1"},
+		{"10.0.0.4/30", []string{"10.0.0.5"}, "10.0.0.6"},
+		{"10.0.0.2/31", nil, "10.0.0.2"},
+		{"10.0.0.2/31", []string{"10.0.0.2"}, "10.0.0.3"},
+		{"10.0.0.9/32", nil, "10.0.0.9"},
+		{"255.255.255.255/32", nil, "255.255.255.255"},
+
+		// Fully allocated
+		{"10.0.0.4/30", []string{"10.0.0.5", "10.0.0.6"}, ""},
+		{"10.0.0.2/31", []string{"10.0.0.2", "10.0.0.3"}, ""},
+		{"10.0.0.9/32", []string{"10.0.0.9"}, ""},
+		{"255.255.255.255/32", []string{"255.255.255.255"}, ""},
+
+		{"not a subnet", nil, ""},
+	} {
+		if got := firstHost(c.subnet, c.taken); got != c.want {
+			t.Errorf("firstHost(%s, %v) = %q, want %q", c.subnet, c.taken, got, c.want)
+		}
+	}
+}